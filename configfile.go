@@ -0,0 +1,182 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// loadConfigFile applies the settings of a TOML config file. Top-level keys are
+// flag names without the leading dash, and keys of an [env] table set the
+// environment variables the tool reads. Flags given on the command line win
+// over the file, as do environment variables that are already set. Only the
+// subset of TOML needed for this is supported: strings, numbers, booleans and
+// single-line arrays of strings.
+func loadConfigFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open config file: %w", err)
+	}
+	defer file.Close()
+
+	// Flags set on the command line take precedence over the file
+	explicit := make(map[string]bool)
+	flag.Visit(func(f *flag.Flag) { explicit[f.Name] = true })
+
+	var unknown []string
+	section := ""
+	scanner := bufio.NewScanner(file)
+	lineNumber := 0
+	for scanner.Scan() {
+		lineNumber++
+		line := strings.TrimSpace(scanner.Text())
+
+		// Skip blank lines and comments
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section = strings.TrimSpace(line[1 : len(line)-1])
+			if section != "env" {
+				return fmt.Errorf("unknown table [%s] on line %d of config file %s", section, lineNumber, path)
+			}
+			continue
+		}
+
+		key, rawValue, found := strings.Cut(line, "=")
+		if !found {
+			return fmt.Errorf("invalid line %d in config file %s", lineNumber, path)
+		}
+		key = strings.Trim(strings.TrimSpace(key), `"`)
+		values, err := parseConfigValue(strings.TrimSpace(rawValue))
+		if err != nil {
+			return fmt.Errorf("invalid value for %s on line %d of config file %s: %w", key, lineNumber, path, err)
+		}
+
+		if section == "env" {
+			if !slices.Contains(configEnvVars, key) {
+				unknown = append(unknown, "env."+key)
+				continue
+			}
+			if len(values) != 1 {
+				return fmt.Errorf("invalid value for %s on line %d of config file %s: expected a single value", key, lineNumber, path)
+			}
+			// Explicitly set environment variables win over the file
+			if _, exists := os.LookupEnv(key); exists {
+				continue
+			}
+			if err := os.Setenv(key, values[0]); err != nil {
+				return fmt.Errorf("failed to set %s: %w", key, err)
+			}
+			continue
+		}
+
+		if key == "config" || flag.Lookup(key) == nil {
+			unknown = append(unknown, key)
+			continue
+		}
+		if explicit[key] {
+			continue
+		}
+		for _, value := range values {
+			if err := flag.Set(key, value); err != nil {
+				return fmt.Errorf("invalid value for %s on line %d of config file %s: %w", key, lineNumber, path, err)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("unknown keys in config file %s: %s", path, strings.Join(unknown, ", "))
+	}
+	return nil
+}
+
+// parseConfigValue parses a TOML value into the flag values it stands for: one
+// for a scalar and one per element for an array
+func parseConfigValue(raw string) ([]string, error) {
+	if strings.HasPrefix(raw, "[") {
+		var values []string
+		rest := strings.TrimSpace(raw[1:])
+		for !strings.HasPrefix(rest, "]") {
+			value, tail, err := parseConfigScalar(rest)
+			if err != nil {
+				return nil, err
+			}
+			values = append(values, value)
+			rest = strings.TrimSpace(tail)
+			if strings.HasPrefix(rest, ",") {
+				rest = strings.TrimSpace(rest[1:])
+			} else if !strings.HasPrefix(rest, "]") {
+				return nil, fmt.Errorf("expected , or ] in array")
+			}
+		}
+		if err := checkTrailingComment(rest[1:]); err != nil {
+			return nil, err
+		}
+		return values, nil
+	}
+
+	value, tail, err := parseConfigScalar(raw)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkTrailingComment(tail); err != nil {
+		return nil, err
+	}
+	return []string{value}, nil
+}
+
+// parseConfigScalar parses a quoted string or a bare number or boolean at the
+// start of raw, returning it and the text after it
+func parseConfigScalar(raw string) (string, string, error) {
+	switch {
+	case raw == "":
+		return "", "", fmt.Errorf("missing value")
+	case raw[0] == '\'':
+		// Literal strings have no escapes
+		end := strings.IndexByte(raw[1:], '\'')
+		if end < 0 {
+			return "", "", fmt.Errorf("unterminated string")
+		}
+		return raw[1 : end+1], raw[end+2:], nil
+	case raw[0] == '"':
+		prefix, err := strconv.QuotedPrefix(raw)
+		if err != nil {
+			return "", "", fmt.Errorf("unterminated or invalid string")
+		}
+		value, err := strconv.Unquote(prefix)
+		if err != nil {
+			return "", "", err
+		}
+		return value, raw[len(prefix):], nil
+	default:
+		end := strings.IndexAny(raw, ",]# \t")
+		if end < 0 {
+			end = len(raw)
+		}
+		value := raw[:end]
+		if value != "true" && value != "false" {
+			if _, err := strconv.ParseFloat(value, 64); err != nil {
+				return "", "", fmt.Errorf("%q is not a string, number or boolean", value)
+			}
+		}
+		return value, raw[end:], nil
+	}
+}
+
+// checkTrailingComment reports an error unless rest is empty or a comment
+func checkTrailingComment(rest string) error {
+	rest = strings.TrimSpace(rest)
+	if rest != "" && !strings.HasPrefix(rest, "#") {
+		return fmt.Errorf("unexpected %q after value", rest)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+package converter
+
+import (
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Takeouts can be zip archives instead of folders. Files inside an archive
+// opened with OpenTakeout are addressed by the archive's path joined with their
+// path in it, e.g. takeout.zip/Takeout/Keep/note.json, so the rest of the
+// converter can treat them like files in a folder.
+
+// zipMagic are the first bytes of a zip archive
+var zipMagic = []byte("PK\x03\x04")
+
+// isZipArchive reports whether the file at path is a zip archive, going by its
+// extension or, failing that, its first bytes
+func isZipArchive(path string) bool {
+	if strings.EqualFold(filepath.Ext(path), ".zip") {
+		return true
+	}
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, len(zipMagic))
+	if _, err := io.ReadFull(file, magic); err != nil {
+		return false
+	}
+	return bytes.Equal(magic, zipMagic)
+}
+
+// OpenTakeout checks that a takeout path is a folder or a zip archive, and opens
+// archives so the notes in them can be processed without extracting them.
+// Close releases the archives once the converter is no longer used.
+func (c *Converter) OpenTakeout(path string) error {
+	fileInfo, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	if fileInfo.IsDir() {
+		return nil
+	}
+	if !isZipArchive(path) {
+		return fmt.Errorf("%s is not a directory or zip archive", path)
+	}
+
+	path = filepath.Clean(path)
+	c.archivesMu.Lock()
+	defer c.archivesMu.Unlock()
+	if _, ok := c.archives[path]; ok {
+		return nil
+	}
+	archive, err := zip.OpenReader(path)
+	if err != nil {
+		return fmt.Errorf("failed to open zip archive %s: %w", path, err)
+	}
+	c.archives[path] = archive
+	return nil
+}
+
+// Close closes every archive opened with OpenTakeout
+func (c *Converter) Close() error {
+	c.archivesMu.Lock()
+	defer c.archivesMu.Unlock()
+	var errs []error
+	for path, archive := range c.archives {
+		errs = append(errs, archive.Close())
+		delete(c.archives, path)
+	}
+	return errors.Join(errs...)
+}
+
+// archiveEntry returns the opened archive containing path and the name of path
+// inside it, or ok false when path isn't inside an archive
+func (c *Converter) archiveEntry(path string) (archive *zip.ReadCloser, archivePath string, name string, ok bool) {
+	path = filepath.Clean(path)
+	c.archivesMu.Lock()
+	defer c.archivesMu.Unlock()
+	for archivePath, archive := range c.archives {
+		if path == archivePath {
+			return archive, archivePath, ".", true
+		}
+		if rest, found := strings.CutPrefix(path, archivePath+string(filepath.Separator)); found {
+			return archive, archivePath, filepath.ToSlash(rest), true
+		}
+	}
+	return nil, "", "", false
+}
+
+// openTakeoutFile opens a file in a takeout folder or archive for reading
+func (c *Converter) openTakeoutFile(path string) (fs.File, error) {
+	if archive, _, name, ok := c.archiveEntry(path); ok {
+		return archive.Open(name)
+	}
+	return os.Open(path)
+}
+
+// statTakeoutFile describes a file in a takeout folder or archive
+func (c *Converter) statTakeoutFile(path string) (fs.FileInfo, error) {
+	if archive, _, name, ok := c.archiveEntry(path); ok {
+		return fs.Stat(archive, name)
+	}
+	return os.Stat(path)
+}
+
+// IsTakeoutDir reports whether path is a folder, in the file system or in an
+// opened archive. An opened archive itself counts as a folder.
+func (c *Converter) IsTakeoutDir(path string) bool {
+	fileInfo, err := c.statTakeoutFile(path)
+	return err == nil && fileInfo.IsDir()
+}
+
+// walkTakeout calls fn for every file and folder below root, which is a folder
+// or an opened archive or a folder in one. An error returned by fn stops the walk.
+func (c *Converter) walkTakeout(root string, fn func(filePath string, isDir bool) error) error {
+	if archive, archivePath, name, ok := c.archiveEntry(root); ok {
+		return fs.WalkDir(archive, name, func(entry string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			return fn(filepath.Join(archivePath, filepath.FromSlash(entry)), d.IsDir())
+		})
+	}
+	return filepath.Walk(root, func(filePath string, fileInfo os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		return fn(filePath, fileInfo.IsDir())
+	})
+}
+
+// localTakeoutFile returns a path in the file system with the content of a
+// takeout file, for the uploaders. Files inside an archive are extracted to a
+// temporary folder, which cleanup removes again.
+func (c *Converter) localTakeoutFile(path string) (localPath string, cleanup func(), err error) {
+	archive, _, name, ok := c.archiveEntry(path)
+	if !ok {
+		return path, func() {}, nil
+	}
+
+	src, err := archive.Open(name)
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to read %s from archive: %w", name, err)
+	}
+	defer src.Close()
+
+	// Keep the file name, which uploaders use for the object name and type
+	dir, err := os.MkdirTemp("", "gkeep2dynalist-")
+	if err != nil {
+		return "", nil, fmt.Errorf("failed to create temporary folder: %w", err)
+	}
+	cleanup = func() { os.RemoveAll(dir) }
+	localPath = filepath.Join(dir, filepath.Base(path))
+	dst, err := os.Create(localPath)
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	_, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, fmt.Errorf("failed to extract %s: %w", name, err)
+	}
+	return localPath, cleanup, nil
+}
@@ -0,0 +1,78 @@
+package converter
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// attachmentSkipReason checks an attachment against the type and size limits
+// and returns why it must not be uploaded, or "" when it may be
+func (c *Converter) attachmentSkipReason(attachment Attachment, filePath string) (string, error) {
+	if c.opts.MaxAttachmentSize > 0 {
+		fileInfo, err := c.statTakeoutFile(filePath)
+		if err != nil {
+			return "", fmt.Errorf("failed to stat attachment: %w", err)
+		}
+		if fileInfo.Size() > c.opts.MaxAttachmentSize {
+			return fmt.Sprintf("%d bytes exceeds the size limit", fileInfo.Size()), nil
+		}
+	}
+
+	if len(c.opts.AttachmentTypes) == 0 && len(c.opts.SkipAttachmentTypes) == 0 {
+		return "", nil
+	}
+	mimeType := attachment.MimeType
+	if mimeType == "" {
+		var err error
+		if mimeType, err = c.sniffMimeType(filePath); err != nil {
+			return "", err
+		}
+	}
+	if len(c.opts.AttachmentTypes) > 0 && !matchesMimeType(mimeType, c.opts.AttachmentTypes) {
+		return fmt.Sprintf("type %s is not allowed", mimeType), nil
+	}
+	if matchesMimeType(mimeType, c.opts.SkipAttachmentTypes) {
+		return fmt.Sprintf("type %s is excluded", mimeType), nil
+	}
+	return "", nil
+}
+
+// sniffMimeType detects a file's MIME type from its first bytes
+func (c *Converter) sniffMimeType(filePath string) (string, error) {
+	file, err := c.openTakeoutFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", fmt.Errorf("failed to read attachment: %w", err)
+	}
+	return http.DetectContentType(head[:n]), nil
+}
+
+// matchesMimeType reports whether a MIME type matches one of the patterns,
+// which are full types ("image/png") or type wildcards ("image/*")
+func matchesMimeType(mimeType string, patterns []string) bool {
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		mimeType = mediaType
+	}
+	mimeType = strings.ToLower(mimeType)
+
+	for _, pattern := range patterns {
+		pattern = strings.ToLower(strings.TrimSpace(pattern))
+		if prefix, ok := strings.CutSuffix(pattern, "/*"); ok {
+			if strings.HasPrefix(mimeType, prefix+"/") {
+				return true
+			}
+		} else if mimeType == pattern {
+			return true
+		}
+	}
+	return false
+}
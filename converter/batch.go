@@ -0,0 +1,139 @@
+package converter
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// batchWait is how long a batch waits for more notes before it is sent anyway
+const batchWait = 500 * time.Millisecond
+
+// batchedNote is a note waiting in a batch to be added to the target document
+type batchedNote struct {
+	node     dynalistChange
+	children []dynalistChange // Continuation and checklist nodes added below the note
+	result   chan error
+}
+
+// batcher collects the notes of concurrent workers and adds them to the target
+// document with a single edit call. Only the document edit API takes several
+// nodes at once, the inbox API adds one item per call.
+type batcher struct {
+	conv     *Converter
+	fileID   string
+	parentID string
+	size     int
+
+	mu      sync.Mutex
+	pending []*batchedNote
+	timer   *time.Timer
+}
+
+// newBatcher returns a batcher sending up to size notes per call
+func newBatcher(conv *Converter, fileID string, parentID string, size int) *batcher {
+	if parentID == "" {
+		parentID = "root"
+	}
+	return &batcher{conv: conv, fileID: fileID, parentID: parentID, size: size}
+}
+
+// add queues a note and waits until its batch was sent, returning the note's
+// own result. A batch is sent once it is full or batchWait after its first note.
+func (b *batcher) add(ctx context.Context, node dynalistChange, children []dynalistChange, retry RetryConfig) error {
+	note := &batchedNote{node: node, children: children, result: make(chan error, 1)}
+
+	b.mu.Lock()
+	b.pending = append(b.pending, note)
+	if len(b.pending) >= b.size {
+		batch := b.take()
+		b.mu.Unlock()
+		b.send(ctx, batch, retry)
+	} else {
+		if len(b.pending) == 1 {
+			b.timer = time.AfterFunc(batchWait, func() {
+				b.mu.Lock()
+				batch := b.take()
+				b.mu.Unlock()
+				b.send(ctx, batch, retry)
+			})
+		}
+		b.mu.Unlock()
+	}
+
+	select {
+	case err := <-note.result:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// take removes and returns the pending notes. The caller must hold b.mu.
+func (b *batcher) take() []*batchedNote {
+	if b.timer != nil {
+		b.timer.Stop()
+		b.timer = nil
+	}
+	batch := b.pending
+	b.pending = nil
+	return batch
+}
+
+// send adds a batch of notes with one call, then their child nodes. When the
+// batch call fails, every note is retried on its own so one bad note doesn't
+// fail the others.
+func (b *batcher) send(ctx context.Context, batch []*batchedNote, retry RetryConfig) {
+	if len(batch) == 0 {
+		return
+	}
+
+	nodes := make([]dynalistChange, len(batch))
+	for i, note := range batch {
+		nodes[i] = note.node
+	}
+	nodeIDs, err := b.conv.addChildrenToDynalist(ctx, b.fileID, b.parentID, nodes, retry)
+	if err == nil && len(nodeIDs) != len(batch) {
+		// Without an ID per note its child nodes can't be placed
+		log.Printf("Warning: Dynalist returned %d node IDs for a batch of %d notes", len(nodeIDs), len(batch))
+		nodeIDs = nil
+	}
+	if err != nil && ctx.Err() == nil {
+		log.Printf("Failed to add a batch of %d notes, adding them one by one: %v", len(batch), err)
+	}
+
+	for i, note := range batch {
+		switch {
+		case ctx.Err() != nil:
+			note.result <- ctx.Err()
+		case err != nil:
+			note.result <- b.sendOne(ctx, note, retry)
+		case nodeIDs == nil:
+			note.result <- nil // Added, but there's no way to add its children
+		default:
+			note.result <- b.addChildren(ctx, nodeIDs[i], note.children, retry)
+		}
+	}
+}
+
+// sendOne adds a single note and its child nodes
+func (b *batcher) sendOne(ctx context.Context, note *batchedNote, retry RetryConfig) error {
+	nodeIDs, err := b.conv.addChildrenToDynalist(ctx, b.fileID, b.parentID, []dynalistChange{note.node}, retry)
+	if err != nil {
+		return err
+	}
+	if len(nodeIDs) == 0 {
+		return nil
+	}
+	return b.addChildren(ctx, nodeIDs[0], note.children, retry)
+}
+
+// addChildren adds the child nodes of a note, if it has any
+func (b *batcher) addChildren(ctx context.Context, nodeID string, children []dynalistChange, retry RetryConfig) error {
+	if len(children) == 0 {
+		return nil
+	}
+	_, err := b.conv.addChildrenToDynalist(ctx, b.fileID, nodeID, children, retry)
+	return err
+}
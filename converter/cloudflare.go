@@ -0,0 +1,123 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// cloudflareR2Client represents a client for Cloudflare R2 storage
+type cloudflareR2Client struct {
+	s3Client   *s3.Client
+	bucketName string
+	accountID  string
+	publicBase string // Links objects under this URL instead of the dashboard when set
+}
+
+// newCloudflareR2Client creates a new Cloudflare R2 client
+func newCloudflareR2Client() (*cloudflareR2Client, error) {
+	// Cloudflare R2 credentials
+	accountID := os.Getenv("CF_ACCOUNT_ID")
+	accessKeyID := os.Getenv("CF_ACCESS_KEY_ID")
+	accessKeySecret := os.Getenv("CF_ACCESS_KEY_SECRET")
+	bucketName := os.Getenv("CF_BUCKET_NAME")
+
+	// Validate required environment variables
+	if missing := missingEnvVars(r2EnvVars); len(missing) > 0 {
+		return nil, fmt.Errorf("missing Cloudflare R2 environment variables: %s", strings.Join(missing, ", "))
+	}
+
+	// Initialize S3 client for Cloudflare R2
+	r2Resolver := aws.EndpointResolverWithOptionsFunc(func(service, region string, options ...interface{}) (aws.Endpoint, error) {
+		return aws.Endpoint{
+			URL: fmt.Sprintf("https://%s.r2.cloudflarestorage.com", accountID),
+		}, nil
+	})
+
+	cfg, err := config.LoadDefaultConfig(context.TODO(),
+		config.WithEndpointResolverWithOptions(r2Resolver),
+		config.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(accessKeyID, accessKeySecret, "")),
+		config.WithRegion("auto"),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+
+	s3Client := s3.NewFromConfig(cfg)
+
+	return &cloudflareR2Client{
+		s3Client:   s3Client,
+		bucketName: bucketName,
+		accountID:  accountID,
+	}, nil
+}
+
+// dashboardURL returns the Cloudflare dashboard URL for an object
+func (c *cloudflareR2Client) dashboardURL(objectPath string) string {
+	return fmt.Sprintf("https://dash.cloudflare.com/%s/r2/default/buckets/%s/objects/%s",
+		c.accountID, c.bucketName, objectPath)
+}
+
+// UploadFile uploads a file to Cloudflare R2 and returns the Cloudflare dashboard URL
+func (c *cloudflareR2Client) UploadFile(ctx context.Context, fileData []byte, fileExt string) (string, error) {
+	// Generate a unique filename
+	timestamp := time.Now().UnixNano()
+	fileName := fmt.Sprintf("%d%s", timestamp, fileExt)
+
+	return c.uploadObject(ctx, fileData, fileName, nil)
+}
+
+// uploadObject uploads data to Cloudflare R2 under the given object key, with optional
+// object metadata, and returns the Cloudflare dashboard URL
+func (c *cloudflareR2Client) uploadObject(ctx context.Context, fileData []byte, fileName string, metadata map[string]string) (string, error) {
+	if err := putObject(ctx, c.s3Client, c.bucketName, fileName, fileData, metadata); err != nil {
+		return "", fmt.Errorf("failed to upload file to R2: %w", err)
+	}
+
+	// Return the Cloudflare dashboard URL
+	return c.ObjectURL(fileName), nil
+}
+
+// ObjectURL returns the Cloudflare dashboard URL of an object's details page,
+// or its public URL when a public base URL is set
+func (c *cloudflareR2Client) ObjectURL(objectKey string) string {
+	if c.publicBase != "" {
+		return publicObjectURL(c.publicBase, objectKey)
+	}
+	return c.dashboardURL(objectKey) + "/details"
+}
+
+// UploadLocalFile uploads a local file to Cloudflare R2 with the given object metadata
+// and returns the Cloudflare dashboard URL
+func (c *cloudflareR2Client) UploadLocalFile(ctx context.Context, filePath string, metadata map[string]string) (string, error) {
+	// Read the file
+	fileData, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	// Generate a unique filename keeping the file extension
+	fileName := fmt.Sprintf("%d%s", time.Now().UnixNano(), filepath.Ext(filePath))
+
+	// Upload the file
+	return c.uploadObject(ctx, fileData, fileName, metadata)
+}
+
+// UploadLocalFileAs uploads a local file to Cloudflare R2 under the given object key
+func (c *cloudflareR2Client) UploadLocalFileAs(ctx context.Context, filePath string, objectKey string, metadata map[string]string) (string, error) {
+	// Read the file
+	fileData, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return c.uploadObject(ctx, fileData, objectKey, metadata)
+}
@@ -0,0 +1,1498 @@
+// Package converter migrates Google Keep takeout notes to Dynalist. It is used by
+// the gkeep2dynalist command and can be embedded in other Go programs.
+package converter
+
+import (
+	"archive/zip"
+	"context"
+	crand "crypto/rand"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"log/slog"
+	"maps"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Options holds the user-configurable settings for a migration run.
+// The zero value migrates every active note to Dynalist with one worker.
+type Options struct {
+	DryRun                   bool // Log notes instead of uploading or sending them
+	EmbedContentHash         bool // Append a #h_xxxxxxxx content hash tag to titles
+	AttachmentGallery        bool // Link one HTML gallery page instead of individual attachments
+	RenameAttachments        bool // Name uploaded attachments after the note title plus an index
+	FlattenAttachments       bool // Link image attachments with image syntax so Dynalist shows them inline
+	PreferHTMLTitle          bool // Title untitled notes with the first heading of their HTML content
+	AbortOnMissingAttachment bool // Fail a note when one of its attachments can't be found
+	FetchURLTitles           bool // Title bare-link notes with the linked page's <title>
+	FoldersAsTags            bool // Tag notes with the folders they are nested in
+	NoTimestamps             bool // Leave the created/edited dates out of the note body
+	IncludeArchived          bool // Migrate archived notes instead of skipping them
+	IncludeTrashed           bool // Migrate trashed notes instead of skipping them
+	IncludeEmpty             bool // Migrate notes without any title, text, items or attachments instead of skipping them
+	NoColorTags              bool // Don't tag notes with their Keep color
+	JSONProgress             bool // Log progress as periodic events instead of drawing a bar
+	AsCheckbox               bool // Create every note as a Dynalist checkbox item
+	RemindersAsTasks         bool // Create notes with a future reminder as checkbox items due at the reminder
+	IdempotencyMarkers       bool // Tag notes with a #k_xxxxxxxxxx marker and skip notes whose marker is known
+	SkipExisting             bool // Skip notes whose marker is already in the DocID document
+	Quiet                    bool // Don't log per-note informational messages, only problems
+	Profile                  bool // Log how long parsing, uploading and adding took for each note
+	SkipDuplicates           bool // Skip notes with the same content as a note seen earlier in the run
+	DuplicateWhitespace      bool // Treat notes that only differ in whitespace as different
+	DuplicateTimestamps      bool // Only treat notes created at the same time as duplicates
+	IncludeSharees           bool // Add who a shared note is shared with to the note body
+	RedactSharees            bool // List sharees by a hash of their email address instead
+
+	TagSeparator string // How words of multi-word labels are joined in tags
+	TagCase      string // Casing applied to label tags
+	TagsPosition string // Where the tags go: after the title, or atop or below the note body
+	Newlines     string // How line breaks in the note body are handled: preserve, collapse or children
+	FieldMapping string // Which Keep fields become the Dynalist item and its note: title, swap or merged
+
+	LabelMap map[string]string // Renames labels, by exact original name, before they become tags
+
+	TagPrefix          string // Namespace prepended to every generated tag, e.g. "keep" for #keep_Work; empty for none
+	TagPrefixSeparator string // Joins TagPrefix and the tag, e.g. "_"
+
+	ColorTagPrefix string // Prefix of tags generated from note colors
+	PinnedTag      string // Tag added to pinned notes, without the #; empty to add none
+
+	TitlePrefix       string // Prepended to every Dynalist item title
+	UniqueTitles      string // How titles used by an earlier note are told apart: date or counter; empty to keep them
+	AttachmentsHeader string // Line introducing the attachment links, omitted when empty
+
+	TimestampFormat string // Go time layout for the created/edited dates
+	OutDir          string // Write Markdown files here instead of sending to Dynalist
+
+	DocID      string // Add notes to this Dynalist document instead of the inbox
+	ParentNode string // Node of DocID the notes are added under, the root when empty
+	RootNode   string // Title of a node created under ParentNode to hold all notes of the run, none when empty
+	DayHeaders bool   // Add notes to DocID oldest first, one at a time, with a "— 2024-03-25 —" node before each day's notes
+
+	LabelColors []LabelColor // Color the DocID nodes of notes by label, the first matching one wins
+
+	Location *time.Location // Time zone the dates are shown in, the local one when nil
+
+	Since time.Time // Only migrate notes created at or after this time
+	Until time.Time // Only migrate notes created before this time
+
+	Labels      []string // Only migrate notes with at least one of these labels
+	Workers     int      // Number of notes processed concurrently
+	BatchSize   int      // Add up to this many notes to DocID per API call, at most Workers
+	MaxNoteSize int      // Split note bodies longer than this many bytes across several nodes
+	MaxFileSize int64    // Reject note files larger than this many bytes instead of parsing them, negative for no limit
+	Limit       int      // Stop after migrating this many notes, 0 for no limit
+
+	AttachmentNoteWorkers int // Number of notes with attachments processed concurrently, at most Workers; 0 for Workers
+
+	FilenameTitleLength int // Characters of the file name used to title untitled notes without text
+	ContentTitleLength  int // Characters of the first line of text used to title untitled notes
+
+	AttachmentTypes     []string // Only upload attachments of these MIME types ("image/*" wildcards allowed)
+	SkipAttachmentTypes []string // Never upload attachments of these MIME types
+	MaxAttachmentSize   int64    // Don't upload attachments larger than this many bytes, 0 for no limit
+
+	Retry         RetryConfig // Pacing and retry settings for Dynalist API calls
+	UploadRetries int         // Retries of a failed attachment upload, backing off like Retry
+
+	NormalizeUnicode string // Unicode normalization applied to the text sent: nfc or nfkc; empty for none
+	TransformCmd     string // Command rewriting each note's title and content as JSON on stdin and stdout
+	TransformFailure string // What a failing TransformCmd does to the note: fail or skip
+
+	Formatter Formatter // Assigns title and body to item content and note; overrides FieldMapping when set
+
+	Token      string        // Dynalist API token, unused for dry runs and Markdown output
+	APIBaseURL string        // Root of the Dynalist API, DefaultAPIBaseURL when empty
+	Uploader   MediaUploader // Where attachments are uploaded; nil leaves them out
+	State      *StateFile    // Skip notes it lists and record the ones migrated
+
+	ProgressOutput io.Writer // Where the progress bar is drawn, stderr when nil
+}
+
+// Converter migrates the notes of Google Keep takeout folders
+type Converter struct {
+	opts Options
+
+	mu       sync.Mutex
+	retries  []noteFile // Notes that failed in the current pass and are retried later
+	failures []string   // Notes that failed on the retry pass too
+	reserved int        // Notes migrated or being migrated, counted against Limit
+
+	existing map[string]bool // Markers found in the target document, read-only once loaded
+	batch    *batcher        // Collects notes for DocID when batching, nil otherwise
+	parentID string          // Node of DocID the notes are added under: ParentNode, or the RootNode once created
+	lastDay  string          // Day of the last day header added with DayHeaders
+
+	seen map[string]string // Content keys of the notes in this run and the file that had them first, guarded by mu
+
+	usedTitles map[string]bool   // Titles given to notes in this run, guarded by mu
+	noteTitles map[string]string // The unique title given to each note file, so retries keep it, guarded by mu
+
+	previous *previousExport // Only migrate notes new or changed relative to this export, nil for all
+
+	archivesMu sync.Mutex
+	archives   map[string]*zip.ReadCloser // Zip takeouts opened by OpenTakeout, by path
+
+	indexesMu sync.Mutex
+	indexes   map[string]map[string][]string // Files of each takeout folder by lowercase name, for attachment lookups
+
+	slugsMu    sync.Mutex
+	slugOwners map[string]string // Which note file claimed each attachment slug
+
+	uploads         *uploadCache  // Attachments already uploaded in this run
+	attachmentSlots chan struct{} // Limits the notes with attachments processed at once, nil for no extra limit
+
+	statsMu    sync.Mutex
+	stats      RunStats
+	plainLines bool       // Print progress lines instead of redrawing the bar, e.g. when piped
+	lastEvent  time.Time  // When the last progress event was logged
+	pass       *PassStats // Statistics of the pass in progress, if any
+
+	runID string // Identifies this run, e.g. in uploaded object metadata
+	pace  *pacer // Adapts the pause between Dynalist API calls
+}
+
+// noteFile is a note file together with the takeout folder it belongs to,
+// which its attachment paths are relative to. A file holding an array of notes
+// is listed once with its number of notes, and each of its notes is handed to
+// the workers decoded, as an element.
+type noteFile struct {
+	path   string
+	folder string
+	notes  int // Notes in a file holding an array of them, 0 for a single-note file
+
+	element int       // Position of the note in its array file, from 1; 0 for a single-note file
+	note    *KeepNote // The decoded note of an element
+	err     error     // Why the element couldn't be decoded
+}
+
+// id identifies the note in the state file, failures and logs: the file path,
+// followed by "#" and the element for notes in an array file
+func (f noteFile) id() string {
+	if f.element == 0 {
+		return f.path
+	}
+	return fmt.Sprintf("%s#%d", f.path, f.element)
+}
+
+// retryPassFactor is how much longer the retry pass backs off than the first pass
+const retryPassFactor = 4
+
+// New validates the options and returns a Converter using them
+func New(opts Options) (*Converter, error) {
+	if opts.TagSeparator == "" {
+		opts.TagSeparator = TagSeparatorUnderscore
+	}
+	if opts.TagCase == "" {
+		opts.TagCase = TagCasePreserve
+	}
+	if opts.TagsPosition == "" {
+		opts.TagsPosition = TagsPositionTitle
+	}
+	if opts.Newlines == "" {
+		opts.Newlines = NewlinesPreserve
+	}
+	if opts.FieldMapping == "" {
+		opts.FieldMapping = FieldMappingTitle
+	}
+	if opts.TransformFailure == "" {
+		opts.TransformFailure = TransformFailNote
+	}
+	if opts.TimestampFormat == "" {
+		opts.TimestampFormat = time.RFC3339
+	}
+	if opts.Location == nil {
+		opts.Location = time.Local
+	}
+	if opts.FilenameTitleLength <= 0 {
+		opts.FilenameTitleLength = DefaultFilenameTitleLength
+	}
+	if opts.ContentTitleLength <= 0 {
+		opts.ContentTitleLength = DefaultContentTitleLength
+	}
+	if opts.MaxNoteSize == 0 {
+		opts.MaxNoteSize = DefaultMaxNoteSize
+	}
+	if opts.MaxFileSize == 0 {
+		opts.MaxFileSize = DefaultMaxFileSize
+	}
+	if opts.Retry == (RetryConfig{}) {
+		opts.Retry = DefaultRetryConfig()
+	}
+	if err := validateTagFormat(opts.TagSeparator, opts.TagCase, opts.TagsPosition); err != nil {
+		return nil, err
+	}
+	opts.TagPrefix = strings.TrimPrefix(opts.TagPrefix, "#")
+	if strings.ContainsFunc(opts.TagPrefix+opts.TagPrefixSeparator, func(r rune) bool { return !isTagRune(r) }) {
+		return nil, fmt.Errorf("tag prefix %q and separator %q may only contain letters, digits, _ and -", opts.TagPrefix, opts.TagPrefixSeparator)
+	}
+	if err := validateNormalization(opts.NormalizeUnicode); err != nil {
+		return nil, err
+	}
+	opts.TransformCmd = strings.TrimSpace(opts.TransformCmd)
+	if err := validateTransform(opts.TransformCmd, opts.TransformFailure); err != nil {
+		return nil, err
+	}
+	if err := validateNewlines(opts.Newlines); err != nil {
+		return nil, err
+	}
+	if err := validateUniqueTitles(opts.UniqueTitles); err != nil {
+		return nil, err
+	}
+	if opts.Formatter == nil {
+		formatter, err := lookupFormatter(opts.FieldMapping)
+		if err != nil {
+			return nil, err
+		}
+		opts.Formatter = formatter
+	}
+	if err := opts.Retry.Validate(); err != nil {
+		return nil, err
+	}
+	if opts.SkipExisting && (opts.DocID == "" || !opts.IdempotencyMarkers) {
+		return nil, fmt.Errorf("skipping existing notes requires a document ID and idempotency markers")
+	}
+	if opts.ParentNode != "" && opts.DocID == "" {
+		return nil, fmt.Errorf("a parent node requires a document ID")
+	}
+	if opts.RootNode != "" && opts.DocID == "" {
+		return nil, fmt.Errorf("a root node requires a document ID")
+	}
+	if opts.DayHeaders && opts.DocID == "" {
+		return nil, fmt.Errorf("day headers require a document ID")
+	}
+	if err := validateLabelColors(opts.LabelColors); err != nil {
+		return nil, err
+	}
+	if opts.AttachmentNoteWorkers < 0 {
+		return nil, fmt.Errorf("attachment note workers must not be negative, got %d", opts.AttachmentNoteWorkers)
+	}
+	if opts.APIBaseURL == "" {
+		opts.APIBaseURL = DefaultAPIBaseURL
+	}
+	if opts.ProgressOutput == nil {
+		opts.ProgressOutput = os.Stderr
+	}
+
+	c := &Converter{
+		opts:       opts,
+		seen:       make(map[string]string),
+		usedTitles: make(map[string]bool),
+		noteTitles: make(map[string]string),
+		archives:   make(map[string]*zip.ReadCloser),
+		indexes:    make(map[string]map[string][]string),
+		slugOwners: make(map[string]string),
+		uploads:    newUploadCache(),
+		runID:      newRunID(),
+		pace:       newPacer(opts.Retry),
+		plainLines: !isTerminal(opts.ProgressOutput),
+		parentID:   opts.ParentNode,
+	}
+	c.stats.Progress.StartTime = time.Now()
+	c.stats.API.PauseCeiling = opts.Retry.MaxPause
+	c.stats.TagCounts = make(map[string]int)
+	// Notes can only be batched into a document, as the inbox API adds one item per
+	// call, and not with day headers, which must land right before their notes
+	if size := min(opts.BatchSize, max(1, opts.Workers)); size > 1 && opts.DocID != "" && !opts.DayHeaders {
+		c.batch = newBatcher(c, opts.DocID, opts.ParentNode, size)
+	}
+	if opts.AttachmentNoteWorkers > 0 && opts.AttachmentNoteWorkers < max(1, opts.Workers) {
+		c.attachmentSlots = make(chan struct{}, opts.AttachmentNoteWorkers)
+	}
+	return c, nil
+}
+
+// ProgressStats counts the notes of a run
+type ProgressStats struct {
+	TotalNotes     int
+	ProcessedNotes int
+	ArchivedNotes  int // Archived notes skipped without IncludeArchived
+	TrashedNotes   int // Trashed notes skipped without IncludeTrashed
+	UnparsedNotes  int // Note files that couldn't be read or decoded
+	FilteredNotes  int // Notes skipped by the -label filter
+	DateFiltered   int // Notes skipped by the -since/-until range
+	NewNotes       int // Notes absent from the previous export
+	ChangedNotes   int // Notes whose content differs from the previous export
+	UnchangedNotes int // Notes skipped because the previous export already had them
+	ResumedNotes   int // Notes skipped because the state file lists them as migrated
+	RecoveredNotes int // Notes that failed at first but succeeded on the retry pass
+	FailedNotes    int // Notes that failed on the retry pass too
+	IgnoredFiles   int // JSON files that aren't Keep notes, e.g. empty or HTML files
+	SkippedUploads int // Attachments left out by the type and size limits
+	DuplicateNotes int // Notes skipped as duplicates of a note earlier in the run
+	EmptyNotes     int // Notes skipped for having no content at all
+	Untransformed  int // Notes skipped because the transform command failed on them
+	StartTime      time.Time
+}
+
+// SkipCount is the number of notes skipped for one reason
+type SkipCount struct {
+	Key         string // Identifier of the reason, e.g. for reports
+	Description string // What was skipped, for the summary
+	Count       int
+}
+
+// SkipCounts returns the number of skipped notes per reason, in summary order
+func (p ProgressStats) SkipCounts() []SkipCount {
+	return []SkipCount{
+		{"archived", "archived notes", p.ArchivedNotes},
+		{"trashed", "trashed notes", p.TrashedNotes},
+		{"empty", "empty notes", p.EmptyNotes},
+		{"parse_error", "unreadable note files", p.UnparsedNotes},
+		{"not_keep_notes", "JSON files that aren't Keep notes", p.IgnoredFiles},
+		{"label_filter", "notes without the requested labels", p.FilteredNotes},
+		{"date_filter", "notes created outside the date range", p.DateFiltered},
+		{"unchanged", "notes unchanged since the previous export", p.UnchangedNotes},
+		{"already_migrated", "notes already migrated by earlier runs", p.ResumedNotes},
+		{"duplicate", "duplicate notes", p.DuplicateNotes},
+		{"transform_failed", "notes the transform command failed on", p.Untransformed},
+		{"failed", "notes that failed on the retry pass too", p.FailedNotes},
+	}
+}
+
+// Skipped returns the number of notes skipped for any reason
+func (p ProgressStats) Skipped() int {
+	total := 0
+	for _, skip := range p.SkipCounts() {
+		total += skip.Count
+	}
+	return total
+}
+
+// PassStats holds the statistics of one pass over the notes
+type PassStats struct {
+	Migrated int // Notes migrated, or recovered on the retry pass
+	Failed   int // Notes that failed, and were queued for the retry pass on the first
+	API      RetryStats
+}
+
+// RunStats holds the statistics of a run. API is the grand total of the API
+// calls, including those made outside the passes, e.g. to read the document.
+type RunStats struct {
+	Progress  ProgressStats
+	API       RetryStats
+	FirstPass PassStats
+	RetryPass PassStats
+	Uploads   UploadStats
+	Timings   TimingStats
+	TagCounts map[string]int // Migrated notes per generated hashtag
+}
+
+// Stats returns a snapshot of the run statistics. It is safe to call while
+// ProcessFolder runs, e.g. to serve metrics, and doesn't redraw the progress bar.
+func (c *Converter) Stats() RunStats {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	stats := c.stats
+	stats.TagCounts = maps.Clone(c.stats.TagCounts)
+	return stats
+}
+
+// RunID identifies this migration run, e.g. in uploaded object metadata
+func (c *Converter) RunID() string {
+	return c.runID
+}
+
+// updateProgress applies a change to the progress statistics and redraws the
+// progress bar. Holding the lock while drawing keeps output from concurrent
+// workers intact.
+func (c *Converter) updateProgress(change func(p *ProgressStats)) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	change(&c.stats.Progress)
+	c.display()
+}
+
+// updateStats applies a change to the run statistics without redrawing the
+// progress bar
+func (c *Converter) updateStats(change func(s *RunStats)) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	change(&c.stats)
+}
+
+// updateAPIStats applies a change to the API statistics of the run and of the
+// pass in progress
+func (c *Converter) updateAPIStats(change func(a *RetryStats)) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	change(&c.stats.API)
+	if c.pass != nil {
+		change(&c.pass.API)
+	}
+}
+
+// updatePass applies a change to the statistics of the pass in progress
+func (c *Converter) updatePass(change func(p *PassStats)) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	if c.pass != nil {
+		change(c.pass)
+	}
+}
+
+// startPass makes the given pass receive the statistics until the next one
+// starts, or none does with nil
+func (c *Converter) startPass(pass *PassStats) {
+	c.statsMu.Lock()
+	defer c.statsMu.Unlock()
+	c.pass = pass
+}
+
+// progressEventInterval is the minimum time between progress events
+const progressEventInterval = 5 * time.Second
+
+// newRunID generates a random (version 4) UUID identifying a run
+func newRunID() string {
+	var b [16]byte
+	if _, err := crand.Read(b[:]); err != nil {
+		return fmt.Sprintf("run-%d", time.Now().UnixNano())
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// display shows the current progress. The caller must hold c.statsMu.
+func (c *Converter) display() {
+	if c.opts.JSONProgress {
+		c.logEvent()
+		return
+	}
+
+	if c.plainLines && !c.eventDue() {
+		return
+	}
+
+	p, s := &c.stats.Progress, &c.stats.API
+	percent := 100.0
+	completed := 1.0
+	if p.TotalNotes > 0 {
+		completed = min(float64(p.ProcessedNotes)/float64(p.TotalNotes), 1)
+		percent = completed * 100
+	}
+	elapsed := time.Since(p.StartTime).Round(time.Second)
+
+	// Create a simple progress bar
+	width := 30
+	filled := int(float64(width) * completed)
+	bar := strings.Repeat("=", filled) + strings.Repeat(" ", width-filled)
+
+	// Terminals redraw the bar in place, anything else gets one line per update
+	format := "\r[%s] %.1f%% (%d/%d) | Elapsed: %s | API: %d ok, %d fail, %d retry | %s"
+	if c.plainLines {
+		format = "[%s] %.1f%% (%d/%d) | Elapsed: %s | API: %d ok, %d fail, %d retry | %s\n"
+	}
+	fmt.Fprintf(c.opts.ProgressOutput, format,
+		bar, percent, p.ProcessedNotes, p.TotalNotes,
+		elapsed, s.SuccessfulCalls, s.FailedCalls, s.Retries,
+		s.LastStatus)
+}
+
+// eventDue reports whether a periodic progress report is due, at most once per
+// progressEventInterval and always once every note is handled, and records it.
+// The caller must hold c.statsMu.
+func (c *Converter) eventDue() bool {
+	p := &c.stats.Progress
+	if time.Since(c.lastEvent) < progressEventInterval && p.ProcessedNotes+p.Skipped() < p.TotalNotes {
+		return false
+	}
+	c.lastEvent = time.Now()
+	return true
+}
+
+// logEvent logs the current progress as a structured event, at most once per
+// progressEventInterval and always once every note is processed. The caller
+// must hold c.statsMu.
+func (c *Converter) logEvent() {
+	if !c.eventDue() {
+		return
+	}
+
+	p, s := &c.stats.Progress, &c.stats.API
+	slog.Info("progress",
+		"processed", p.ProcessedNotes,
+		"skipped", p.Skipped(),
+		"total", p.TotalNotes,
+		"elapsed", time.Since(p.StartTime).Round(time.Second).String(),
+		"api_ok", s.SuccessfulCalls,
+		"api_failed", s.FailedCalls,
+		"api_retries", s.Retries)
+}
+
+// isTerminal reports whether the writer is an interactive terminal
+func isTerminal(w io.Writer) bool {
+	file, ok := w.(*os.File)
+	if !ok {
+		return false
+	}
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return fileInfo.Mode()&os.ModeCharDevice != 0
+}
+
+// CountNotes returns how many note files the folders hold, leaving out those
+// the state file lists as migrated, e.g. to confirm a large run before it starts
+func (c *Converter) CountNotes(folderPaths ...string) (int, error) {
+	files, err := c.collectNoteFiles(context.Background(), folderPaths)
+	if err != nil {
+		return 0, err
+	}
+	return c.pendingCount(files), nil
+}
+
+// collectNoteFiles lists the JSON files of the folders, in order
+func (c *Converter) collectNoteFiles(ctx context.Context, folderPaths []string) ([]noteFile, error) {
+	var files []noteFile
+	for _, folderPath := range folderPaths {
+		err := c.walkTakeout(folderPath, func(filePath string, isDir bool) error {
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+
+			// Process only JSON files
+			if !isDir && filepath.Ext(filePath) == ".json" {
+				files = append(files, noteFile{path: filePath, folder: folderPath, notes: c.countNoteArray(filePath)})
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return files, nil
+}
+
+// pendingCount returns how many of the files the state file doesn't list as migrated
+func (c *Converter) pendingCount(files []noteFile) int {
+	remaining := 0
+	for _, file := range files {
+		if file.notes == 0 {
+			if c.opts.State == nil || !c.opts.State.IsDone(file.path) {
+				remaining++
+			}
+			continue
+		}
+		for element := 1; element <= file.notes; element++ {
+			id := noteFile{path: file.path, element: element}.id()
+			if c.opts.State == nil || !c.opts.State.IsDone(id) {
+				remaining++
+			}
+		}
+	}
+	return remaining
+}
+
+// ProcessFolder migrates every note in one or more Google Keep takeout folders,
+// in order, as a single run. Notes that fail are logged and counted in Stats;
+// the returned error only reports problems reading the folders or a cancelled
+// context. Cancelling the context stops the run promptly, abandoning the notes
+// still in flight.
+func (c *Converter) ProcessFolder(ctx context.Context, folderPaths ...string) error {
+	// Collect the JSON files first so they can be shared between workers
+	files, err := c.collectNoteFiles(ctx, folderPaths)
+	if err != nil {
+		return err
+	}
+	// Find the notes earlier runs already added to the target document
+	if c.opts.SkipExisting {
+		nodes, err := c.readDocument(ctx, c.opts.DocID, c.opts.Retry)
+		if err != nil {
+			return fmt.Errorf("failed to read target document: %w", err)
+		}
+		c.existing = make(map[string]bool)
+		for _, node := range nodes {
+			for _, marker := range noteMarkerPattern.FindAllString(node.Content+"\n"+node.Note, -1) {
+				c.existing[marker] = true
+			}
+		}
+		c.logInfo(fmt.Sprintf("Target document already has %d migrated notes", len(c.existing)))
+	}
+
+	// Day headers need the notes in order
+	if c.opts.DayHeaders {
+		c.sortByCreated(files)
+	}
+
+	// Notes earlier runs migrated are skipped, so they aren't part of the work left
+	remaining := c.pendingCount(files)
+	c.updateProgress(func(p *ProgressStats) {
+		p.TotalNotes = remaining
+		if c.opts.Limit > 0 {
+			p.TotalNotes = min(p.TotalNotes, c.opts.Limit)
+		}
+	})
+	// Gather the notes of this run under a single new node
+	if c.opts.RootNode != "" && remaining > 0 {
+		if err := c.createRootNode(ctx); err != nil {
+			return err
+		}
+	}
+
+	c.startPass(&c.stats.FirstPass)
+	defer c.startPass(nil)
+	c.runPass(ctx, files, c.opts.Retry, false)
+
+	// Give notes that failed a second chance, backing off longer between retries
+	c.mu.Lock()
+	retries := c.retries
+	c.retries = nil
+	c.mu.Unlock()
+	if len(retries) > 0 && ctx.Err() == nil {
+		c.logInfo(fmt.Sprintf("Retrying %d failed notes", len(retries)))
+		retry := c.opts.Retry
+		retry.MinDelay *= retryPassFactor
+		retry.MaxDelay *= retryPassFactor
+		c.startPass(&c.stats.RetryPass)
+		c.runPass(ctx, retries, retry, true)
+	}
+
+	return ctx.Err()
+}
+
+// createRootNode adds the RootNode under ParentNode, once per run, and makes it
+// the parent of every note
+func (c *Converter) createRootNode(ctx context.Context) error {
+	if c.parentID != c.opts.ParentNode || c.opts.OutDir != "" {
+		return nil // Already created, or notes don't go to Dynalist
+	}
+	title := c.normalize(c.opts.RootNode)
+	if c.opts.DryRun {
+		log.Printf("[dry-run] notes would be added under a new node %q", title)
+		return nil
+	}
+
+	resp, err := c.addToDocument(ctx, c.opts.DocID, c.opts.ParentNode, title, "", false, false, 0, c.opts.Retry)
+	if err != nil {
+		return fmt.Errorf("failed to create root node: %w", err)
+	}
+	c.parentID = resp.NodeID
+	if c.batch != nil {
+		c.batch.parentID = resp.NodeID
+	}
+	c.logInfo(fmt.Sprintf("Adding notes under the new node %q", title), "node", resp.NodeID)
+	return nil
+}
+
+// Failures returns the notes that failed on both the first and the retry pass
+func (c *Converter) Failures() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]string(nil), c.failures...)
+}
+
+// runPass processes the given note files with a pool of workers. Notes that
+// fail are queued for the retry pass, or recorded as failures on the retry pass.
+func (c *Converter) runPass(ctx context.Context, files []noteFile, retry RetryConfig, retryPass bool) {
+	workers := max(1, c.opts.Workers)
+	if c.opts.DayHeaders {
+		workers = 1 // Keep the notes in order between their day headers
+	}
+
+	jobs := make(chan noteFile)
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				c.processNoteFile(ctx, file, retry, retryPass)
+			}
+		}()
+	}
+
+	// send hands a note to the workers, reporting whether to go on
+	send := func(file noteFile) bool {
+		if c.limitReached() {
+			return false
+		}
+		select {
+		case jobs <- file:
+			return true
+		case <-ctx.Done():
+			return false
+		}
+	}
+	for _, file := range files {
+		if file.notes == 0 {
+			if !send(file) {
+				break
+			}
+			continue
+		}
+
+		// Decode array files here, one note at a time, as workers can't share a decoder
+		more := true
+		_, err := c.streamNoteArray(file.path, func(element int, note *KeepNote, err error) bool {
+			more = send(noteFile{path: file.path, folder: file.folder, element: element, note: note, err: err})
+			return more
+		})
+		if err != nil {
+			slog.Error("Failed to read notes", "file", file.path, "error", err)
+			c.updateProgress(func(p *ProgressStats) { p.UnparsedNotes += file.notes })
+		}
+		if !more {
+			break
+		}
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// logInfo logs an informational message unless the converter is quiet.
+// Detail that is only useful when debugging is logged with slog.Debug instead.
+func (c *Converter) logInfo(msg string, args ...any) {
+	if !c.opts.Quiet {
+		slog.Info(msg, args...)
+	}
+}
+
+// firstWithContent returns the file of an earlier note in the run with the same
+// content as this one, or "" and remembers this note when there is none
+func (c *Converter) firstWithContent(note *KeepNote, filePath string) string {
+	key := duplicateKey(note, c.opts.DuplicateWhitespace, c.opts.DuplicateTimestamps)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if original, ok := c.seen[key]; ok && original != filePath {
+		return original
+	}
+	c.seen[key] = filePath
+	return ""
+}
+
+// reserve claims one of the -limit slots for a note about to be migrated,
+// reporting false when all of them are taken
+func (c *Converter) reserve() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.opts.Limit > 0 && c.reserved >= c.opts.Limit {
+		return false
+	}
+	c.reserved++
+	return true
+}
+
+// limitReached reports whether every -limit slot is taken
+func (c *Converter) limitReached() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.opts.Limit > 0 && c.reserved >= c.opts.Limit
+}
+
+// processNoteFile parses, filters and migrates a single note file, recording the outcome in Progress
+func (c *Converter) processNoteFile(ctx context.Context, file noteFile, retry RetryConfig, retryPass bool) {
+	state, previous := c.opts.State, c.previous
+	filePath, folderPath := file.id(), file.folder
+
+	// Skip notes migrated by an earlier run
+	if state != nil && state.IsDone(filePath) {
+		slog.Debug("Skipping note listed in the state file", "file", filePath)
+		c.updateProgress(func(p *ProgressStats) { p.ResumedNotes++ })
+		return
+	}
+
+	// Parse the Keep Note
+	timing := &noteTiming{}
+	parseStart := time.Now()
+	note, err := file.note, file.err
+	if file.element == 0 {
+		note, err = c.parseKeepNote(file.path, c.opts.MaxFileSize)
+	}
+	timing.parse = time.Since(parseStart)
+	if errors.Is(err, ErrNotKeepNote) || errors.Is(err, errNoteArray) { // Only empty arrays get here
+		c.logInfo("Ignoring file that is not a Keep note", "file", filePath, "reason", err)
+		c.updateProgress(func(p *ProgressStats) { p.IgnoredFiles++ })
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to parse Keep note", "file", filePath, "error", err)
+		c.updateProgress(func(p *ProgressStats) { p.UnparsedNotes++ })
+		return // Continue processing other files
+	}
+
+	// Ignore archived and trashed notes unless asked to include them
+	if note.IsArchived && !c.opts.IncludeArchived {
+		c.logInfo("Ignoring archived note", "file", filePath, "title", note.Title)
+		c.updateProgress(func(p *ProgressStats) { p.ArchivedNotes++ })
+		return
+	}
+	if note.IsTrashed && !c.opts.IncludeTrashed {
+		c.logInfo("Ignoring trashed note", "file", filePath, "title", note.Title)
+		c.updateProgress(func(p *ProgressStats) { p.TrashedNotes++ })
+		return
+	}
+
+	// Empty notes would only become bare titles
+	if isEmptyNote(note) && !c.opts.IncludeEmpty {
+		slog.Debug("Skipping empty note", "file", filePath)
+		c.updateProgress(func(p *ProgressStats) { p.EmptyNotes++ })
+		return
+	}
+
+	// Only migrate notes created within the requested date range
+	if !c.opts.Since.IsZero() || !c.opts.Until.IsZero() {
+		created := usecToTime(note.CreatedTimestampUsec, c.opts.Location)
+		if (!c.opts.Since.IsZero() && created.Before(c.opts.Since)) || (!c.opts.Until.IsZero() && !created.Before(c.opts.Until)) {
+			slog.Debug("Skipping note created outside the date range", "file", filePath, "title", note.Title)
+			c.updateProgress(func(p *ProgressStats) { p.DateFiltered++ })
+			return
+		}
+	}
+
+	// Only migrate notes with one of the requested labels
+	if len(c.opts.Labels) > 0 && !hasAnyLabel(note, c.opts.Labels) {
+		slog.Debug("Skipping note without the requested labels", "file", filePath, "title", note.Title)
+		c.updateProgress(func(p *ProgressStats) { p.FilteredNotes++ })
+		return
+	}
+
+	// Only migrate notes that are new or changed since the previous export
+	isNew := false
+	if previous != nil {
+		if previous.isUnchanged(note) {
+			slog.Debug("Skipping note unchanged since the previous export", "file", filePath, "title", note.Title)
+			c.updateProgress(func(p *ProgressStats) { p.UnchangedNotes++ })
+			return
+		}
+		relPath, err := filepath.Rel(folderPath, filePath)
+		if err == nil {
+			isNew = !previous.isKnown(relPath)
+		}
+	}
+
+	// Skip notes whose marker shows they were migrated before, even from another path
+	var marker string
+	if c.opts.IdempotencyMarkers {
+		marker = noteMarker(note)
+		if c.existing[marker] || (state != nil && state.HasMarker(marker)) {
+			slog.Debug("Skipping note with a known idempotency marker", "file", filePath, "marker", marker)
+			c.updateProgress(func(p *ProgressStats) { p.ResumedNotes++ })
+			return
+		}
+	}
+
+	// Skip copies of a note already handled in this run, e.g. from another export
+	if c.opts.SkipDuplicates {
+		if original := c.firstWithContent(note, filePath); original != "" {
+			slog.Debug("Skipping duplicate note", "file", filePath, "title", note.Title, "original", original)
+			c.updateProgress(func(p *ProgressStats) { p.DuplicateNotes++ })
+			return
+		}
+	}
+
+	// Notes with attachments are heavier, so fewer of them may run at once
+	if len(note.Attachments) > 0 && c.attachmentSlots != nil {
+		select {
+		case c.attachmentSlots <- struct{}{}:
+			defer func() { <-c.attachmentSlots }()
+		case <-ctx.Done():
+			return // Interrupted, leave the note for the next run
+		}
+	}
+
+	// Stop once the requested number of notes is migrated
+	if !c.reserve() {
+		return
+	}
+
+	// Process the message
+	err = c.processMessage(ctx, note, folderPath, filePath, retry, timing)
+	if ctx.Err() != nil {
+		return // Interrupted, leave the note for the next run
+	}
+	if errors.Is(err, errTransformSkipped) {
+		c.mu.Lock()
+		c.reserved-- // Let another note take its place
+		c.mu.Unlock()
+		c.updateProgress(func(p *ProgressStats) { p.Untransformed++ })
+		return
+	}
+	if err != nil {
+		slog.Error("Failed to process message", "file", filePath, "title", note.Title, "error", err)
+		c.mu.Lock()
+		c.reserved-- // Let another note take its place
+		if retryPass {
+			c.failures = append(c.failures, filePath)
+		} else {
+			c.retries = append(c.retries, file)
+		}
+		c.mu.Unlock()
+		c.updatePass(func(p *PassStats) { p.Failed++ })
+		if retryPass {
+			c.updateProgress(func(p *ProgressStats) { p.FailedNotes++ })
+		}
+		return // Continue processing other files
+	}
+
+	// Record the note so a re-run won't send it again
+	if state != nil && !c.opts.DryRun {
+		if err := state.MarkDone(filePath); err != nil {
+			log.Printf("Failed to record migrated note: %v", err)
+		}
+		if marker != "" {
+			if err := state.MarkMarker(marker); err != nil {
+				log.Printf("Failed to record migrated note: %v", err)
+			}
+		}
+	}
+
+	// Update progress
+	slog.Debug("Migrated note", "file", filePath, "title", note.Title)
+	if c.opts.Profile {
+		c.recordTiming(timing, filePath, note.Title)
+	}
+	c.updatePass(func(p *PassStats) { p.Migrated++ })
+	c.updateProgress(func(p *ProgressStats) {
+		if previous != nil {
+			if isNew {
+				p.NewNotes++
+			} else {
+				p.ChangedNotes++
+			}
+		}
+		if retryPass {
+			p.RecoveredNotes++
+		}
+		p.ProcessedNotes++
+	})
+}
+
+// processMessage uploads a note's attachments and sends it to its destination,
+// recording how long both took in timing
+func (c *Converter) processMessage(ctx context.Context, note *KeepNote, folderPath string, filePath string, retry RetryConfig, timing *noteTiming) error {
+	uploader := c.opts.Uploader
+	uploadStart := time.Now()
+
+	var attachmentLinks []string
+	var galleryItems []galleryItem
+	// Process attachments
+	if uploader != nil && len(note.Attachments) > 0 {
+		metadata := attachmentMetadata(note, filePath, c.runID)
+
+		var slug string
+		if c.opts.RenameAttachments {
+			slug = c.attachmentSlug(note, filePath)
+		}
+
+		for i, attachment := range note.Attachments {
+			attachmentFile, err := c.findAttachmentFile(folderPath, attachment.FilePath)
+			if err != nil {
+				if c.opts.AbortOnMissingAttachment {
+					return err
+				}
+				log.Printf("Failed to find attachment file: %v", err)
+				continue // Continue processing other attachments
+			}
+
+			// Leave out attachments of unwanted types or sizes
+			reason, err := c.attachmentSkipReason(attachment, attachmentFile)
+			if err != nil {
+				log.Printf("Failed to check attachment: %v", err)
+				continue
+			}
+			if reason != "" {
+				c.logInfo(fmt.Sprintf("Skipping attachment %s: %s", attachment.FilePath, reason), "file", filePath)
+				c.updateProgress(func(p *ProgressStats) { p.SkippedUploads++ })
+				continue
+			}
+
+			name := attachment.FilePath
+			if c.opts.RenameAttachments {
+				name = fmt.Sprintf("%s-%d%s", slug, i+1, filepath.Ext(attachment.FilePath))
+			}
+
+			var uploadURL string
+			if c.opts.DryRun {
+				uploadURL = uploader.ObjectURL(name)
+			} else {
+				uploadURL, err = c.uploadAttachment(ctx, attachmentFile, name, metadata)
+			}
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				log.Printf("Failed to upload attachment: %v", err)
+				continue // Continue processing other attachments
+			}
+
+			// Images render inline with image syntax, other files stay plain links
+			isImage := matchesMimeType(attachment.MimeType, []string{"image/*"})
+			link := fmt.Sprintf("[%s](%s)", name, uploadURL)
+			if c.opts.FlattenAttachments && isImage {
+				link = "!" + link
+			}
+			// Tell handwritten drawings apart from photos
+			if isDrawing(attachment) {
+				link = "Drawing: " + link
+			}
+			attachmentLinks = append(attachmentLinks, link)
+			galleryItems = append(galleryItems, galleryItem{Name: name, URL: uploadURL, Image: isImage})
+		}
+	}
+
+	// Show the preview images of web clips with their links
+	if uploader != nil {
+		if err := c.uploadThumbnails(ctx, note, folderPath, filePath); err != nil {
+			return err
+		}
+	}
+
+	// Replace the individual links with a single gallery page link
+	if c.opts.AttachmentGallery && len(galleryItems) > 0 {
+		var galleryURL string
+		var err error
+		if c.opts.DryRun {
+			galleryURL = uploader.ObjectURL("gallery.html")
+		} else {
+			galleryURL, err = c.uploadWithRetry(ctx, func() (string, error) {
+				return uploader.UploadFile(ctx, buildGalleryHTML(note.Title, galleryItems), ".html")
+			})
+		}
+		if err != nil {
+			log.Printf("Failed to upload attachment gallery, keeping individual links: %v", err)
+		} else {
+			attachmentLinks = []string{fmt.Sprintf("[Gallery (%d attachments)](%s)", len(galleryItems), galleryURL)}
+		}
+	}
+
+	timing.upload = time.Since(uploadStart)
+
+	// Title bare-link notes with the linked page's title, keeping the URL as content.
+	// The note itself keeps its empty title, so hashes and tags don't depend on the fetch.
+	baseTitle := c.buildBaseTitle(note, filePath)
+	if note.Title == "" && c.opts.FetchURLTitles {
+		if link := singleURL(note.TextContent); link != "" {
+			baseTitle = fetchURLTitle(ctx, link)
+		}
+	}
+
+	title, noteContent := c.noteText(note, folderPath, filePath, baseTitle, attachmentLinks)
+	items := c.normalizeItems(note.ListContent)
+
+	// Let an external command rewrite the note
+	if c.opts.TransformCmd != "" {
+		var err error
+		title, noteContent, err = c.transform(ctx, note, filePath, title, noteContent)
+		if err != nil && ctx.Err() == nil && c.opts.TransformFailure == TransformSkipNote {
+			slog.Error("Skipping note", "file", filePath, "title", note.Title, "error", err)
+			return errTransformSkipped
+		}
+		if err != nil {
+			return err
+		}
+	}
+
+	// Assign the title and body to the Dynalist item and its note
+	content, body := c.opts.Formatter(title, noteContent)
+
+	// Turn notes with a future reminder into tasks due then
+	checkbox := c.opts.AsCheckbox
+	if c.opts.RemindersAsTasks && c.opts.OutDir == "" {
+		if due := nextReminder(note, time.Now()); !due.IsZero() {
+			content += " " + dueMarker(due, c.opts.Location)
+			checkbox = true
+		}
+	}
+
+	// Only show what would be sent
+	if c.opts.DryRun {
+		if c.opts.DayHeaders {
+			c.addDayHeader(ctx, note, retry)
+		}
+		if checkbox {
+			content = checkboxMarker(noteChecked(note)) + " " + content
+		}
+		log.Printf("[dry-run] %s\nTitle: %s\nNote:\n%s", filePath, content, body)
+		if c.opts.Newlines == NewlinesChildren {
+			log.Printf("[dry-run]   note lines would become %d child items", len(lineNodes(body)))
+		} else if parts := splitContent(body, c.opts.MaxNoteSize); len(parts) > 1 {
+			log.Printf("[dry-run]   note would be split into %d parts", len(parts))
+		}
+		for _, item := range items {
+			log.Printf("[dry-run]   %s %s", checkboxMarker(item.IsChecked), item.Text)
+		}
+		c.countTags(c.buildHashtags(note, folderPath, filePath))
+		return nil
+	}
+
+	addStart := time.Now()
+	defer func() { timing.add = time.Since(addStart) }()
+
+	// Write the note to a local Markdown file instead of Dynalist, with the item
+	// as heading and its note below, as they would be sent. Items of several
+	// lines, e.g. with the merged field mapping, continue below the heading.
+	if c.opts.OutDir != "" {
+		heading, rest, _ := strings.Cut(content, "\n")
+		if rest = strings.TrimSpace(rest); rest != "" {
+			body = strings.TrimRight(rest+"\n\n"+body, "\n")
+		}
+		// Name the file after the heading without the tags it may end with
+		hashtags := c.buildHashtags(note, folderPath, filePath)
+		name := strings.TrimSuffix(heading, " "+c.normalize(hashtags))
+		_, err := writeMarkdownNote(c.opts.OutDir, name, heading, body, items)
+		if err != nil {
+			log.Printf("Failed to write Markdown note: %v", err)
+			return err
+		}
+		c.countTags(hashtags)
+		return nil
+	}
+
+	// Keep notes within Dynalist's size limit, continuing long ones in child nodes,
+	// unless every line becomes a child node anyway
+	var children []dynalistChange
+	if c.opts.Newlines == NewlinesChildren {
+		children = lineNodes(body)
+		body = ""
+	} else {
+		parts := splitContent(body, c.opts.MaxNoteSize)
+		body = parts[0]
+		children = continuationNodes(parts)
+	}
+	// Checklist items follow as checkboxes
+	children = append(children, checklistNodes(items)...)
+
+	// Forward the message to the Dynalist inbox, or the requested document
+	checked := checkbox && noteChecked(note)
+	if c.batch != nil {
+		node := dynalistChange{Content: content, Note: body, Checkbox: checkbox, Checked: checked, Color: c.labelColor(note)}
+		if err := c.batch.add(ctx, node, children, retry); err != nil {
+			log.Printf("Failed to add message to Dynalist: %v", err)
+			return err
+		}
+		c.countTags(c.buildHashtags(note, folderPath, filePath))
+		return nil
+	}
+
+	var resp *dynalistResponse
+	var err error
+	if c.opts.DayHeaders {
+		if err := c.addDayHeader(ctx, note, retry); err != nil {
+			log.Printf("Failed to add day header to Dynalist: %v", err)
+			return err
+		}
+	}
+	if c.opts.DocID != "" {
+		resp, err = c.addToDocument(ctx, c.opts.DocID, c.parentID, content, body, checkbox, checked, c.labelColor(note), retry)
+	} else {
+		resp, err = c.addToDynalist(ctx, content, body, checkbox, checked, retry)
+	}
+	if err != nil {
+		log.Printf("Failed to add message to Dynalist: %v", err)
+		return err
+	}
+
+	// Add the rest of a split note, or its lines, then checklist items under the note
+	if len(children) > 0 {
+		_, err = c.addChildrenToDynalist(ctx, resp.FileID, resp.NodeID, children, retry)
+		if err != nil {
+			log.Printf("Failed to add child items to Dynalist: %v", err)
+			return err
+		}
+	}
+
+	c.countTags(c.buildHashtags(note, folderPath, filePath))
+
+	return nil
+}
+
+// noteText builds the title and body text of a note from its base title and
+// attachment links, as they are handed to the transform command and Formatter
+func (c *Converter) noteText(note *KeepNote, folderPath string, filePath string, baseTitle string, attachmentLinks []string) (title string, noteContent string) {
+	// Format the note content, with the text recognized in drawings as body
+	noteContent = note.TextContent
+	if text := drawingText(note.Attachments); text != "" {
+		noteContent = strings.TrimLeft(noteContent+"\n\n"+text, "\n")
+	}
+	if links := annotationLines(note.Annotations); len(links) > 0 {
+		noteContent = strings.TrimLeft(noteContent+"\n\nLinks:\n"+strings.Join(links, "\n"), "\n")
+	}
+	if len(attachmentLinks) > 0 {
+		header := ""
+		if c.opts.AttachmentsHeader != "" {
+			header = c.opts.AttachmentsHeader + "\n"
+		}
+		noteContent += "\n\n" + header + strings.Join(attachmentLinks, "\n")
+	}
+
+	// Say who a shared note was shared with
+	if c.opts.IncludeSharees {
+		if line := shareesLine(note.Sharees, c.opts.RedactSharees); line != "" {
+			noteContent = strings.TrimLeft(noteContent+"\n\n"+line, "\n")
+		}
+	}
+
+	// Preserve when the note was written
+	if !c.opts.NoTimestamps {
+		if footer := timestampFooter(note, c.opts.TimestampFormat, c.opts.Location); footer != "" {
+			noteContent = strings.TrimLeft(noteContent+"\n\n"+footer, "\n")
+		}
+	}
+
+	// Tags go in the title unless they were asked for in the note body
+	if hashtags := c.buildHashtags(note, folderPath, filePath); hashtags != "" {
+		switch c.opts.TagsPosition {
+		case TagsPositionNoteTop:
+			noteContent = strings.TrimRight(hashtags+"\n\n"+noteContent, "\n")
+		case TagsPositionNoteBottom:
+			noteContent = strings.TrimLeft(noteContent+"\n\n"+hashtags, "\n")
+		}
+	}
+
+	if c.opts.Newlines == NewlinesCollapse {
+		noteContent = blankLinesPattern.ReplaceAllString(noteContent, "\n\n")
+	}
+
+	// Normalize the text that is sent, leaving markers and hashes computed from the original
+	return c.normalize(c.buildTitle(baseTitle, note, folderPath, filePath)), c.normalize(noteContent)
+}
+
+// uploadThumbnails uploads the thumbnails of a note's web clip annotations like
+// attachments and records their URLs in the annotations. Thumbnails that can't be
+// found or uploaded are left out, as the links still work without them.
+func (c *Converter) uploadThumbnails(ctx context.Context, note *KeepNote, folderPath string, filePath string) error {
+	var metadata map[string]string
+	for i := range note.Annotations {
+		annotation := &note.Annotations[i]
+		if annotation.Thumbnail == "" {
+			continue
+		}
+		thumbnailFile, err := c.findAttachmentFile(folderPath, annotation.Thumbnail)
+		if err != nil {
+			log.Printf("Failed to find thumbnail file: %v", err)
+			continue
+		}
+		reason, err := c.attachmentSkipReason(Attachment{FilePath: annotation.Thumbnail}, thumbnailFile)
+		if err != nil {
+			log.Printf("Failed to check thumbnail: %v", err)
+			continue
+		}
+		if reason != "" {
+			c.logInfo(fmt.Sprintf("Skipping thumbnail %s: %s", annotation.Thumbnail, reason), "file", filePath)
+			c.updateProgress(func(p *ProgressStats) { p.SkippedUploads++ })
+			continue
+		}
+
+		name := annotation.Thumbnail
+		if c.opts.RenameAttachments {
+			name = fmt.Sprintf("%s-thumbnail-%d%s", c.attachmentSlug(note, filePath), i+1, filepath.Ext(annotation.Thumbnail))
+		}
+		if c.opts.DryRun {
+			annotation.ThumbnailURL = c.opts.Uploader.ObjectURL(name)
+			continue
+		}
+		if metadata == nil {
+			metadata = attachmentMetadata(note, filePath, c.runID)
+		}
+		url, err := c.uploadAttachment(ctx, thumbnailFile, name, metadata)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if err != nil {
+			log.Printf("Failed to upload thumbnail: %v", err)
+			continue
+		}
+		annotation.ThumbnailURL = url
+	}
+	return nil
+}
+
+// uploadAttachment uploads an attachment file, under name with RenameAttachments.
+// Attachments inside a zip takeout are extracted for the upload. A file already
+// uploaded in this run isn't uploaded again, the earlier object's URL is returned.
+func (c *Converter) uploadAttachment(ctx context.Context, attachmentFile string, name string, metadata map[string]string) (string, error) {
+	localFile, cleanup, err := c.localTakeoutFile(attachmentFile)
+	if err != nil {
+		return "", err
+	}
+	defer cleanup()
+
+	key, err := c.uploadKey(localFile, name)
+	if err != nil {
+		return "", err
+	}
+	uploader := c.opts.Uploader
+	url, hit, err := c.uploads.upload(key, func() (string, error) {
+		return c.uploadWithRetry(ctx, func() (string, error) {
+			if c.opts.RenameAttachments {
+				return uploader.UploadLocalFileAs(ctx, localFile, name, metadata)
+			}
+			return uploader.UploadLocalFile(ctx, localFile, metadata)
+		})
+	})
+	if hit {
+		c.updateStats(func(s *RunStats) { s.Uploads.Deduplicated++ })
+	}
+	return url, err
+}
+
+// attachmentMetadata returns the object metadata stored with a note's uploaded attachments.
+// It preserves the note's original timestamps so the bucket keeps its chronology, and
+// records the source note and run ID so objects can be traced back to the migration.
+func attachmentMetadata(note *KeepNote, filePath string, runID string) map[string]string {
+	metadata := map[string]string{
+		"run-id":      runID,
+		"source-note": url.PathEscape(filepath.Base(filePath)),
+	}
+	if note.CreatedTimestampUsec != 0 {
+		metadata["created"] = time.UnixMicro(note.CreatedTimestampUsec).UTC().Format(time.RFC3339)
+	}
+	if note.UserEditedTimestampUsec != 0 {
+		metadata["edited"] = time.UnixMicro(note.UserEditedTimestampUsec).UTC().Format(time.RFC3339)
+	}
+	return metadata
+}
+
+// noteChecked reports whether a note counts as done when migrated as a checkbox:
+// archived and trashed notes are, and so are checklists whose items are all checked
+func noteChecked(note *KeepNote) bool {
+	if note.IsArchived || note.IsTrashed {
+		return true
+	}
+	if len(note.ListContent) == 0 {
+		return false
+	}
+	for _, item := range note.ListContent {
+		if !item.IsChecked {
+			return false
+		}
+	}
+	return true
+}
+
+// checkboxMarker returns the Markdown task marker for a checked state
+func checkboxMarker(checked bool) string {
+	if checked {
+		return "[x]"
+	}
+	return "[ ]"
+}
+
+// checklistNodes converts Keep checklist items to Dynalist checkbox nodes, keeping their order
+func checklistNodes(items []ListItem) []dynalistChange {
+	nodes := make([]dynalistChange, 0, len(items))
+	for _, item := range items {
+		nodes = append(nodes, dynalistChange{
+			Content:  item.Text,
+			Checkbox: true,
+			Checked:  item.IsChecked,
+		})
+	}
+	return nodes
+}
+
+// buildHashtags collects every hashtag generated for a note
+func (c *Converter) buildHashtags(note *KeepNote, folderPath string, filePath string) string {
+	// Process labels and the note color, namespaced by the tag prefix
+	namespace := ""
+	if c.opts.TagPrefix != "" {
+		namespace = c.opts.TagPrefix + c.opts.TagPrefixSeparator
+	}
+	hashtags := processLabels(note.Labels, c.opts.LabelMap, namespace, c.opts.TagSeparator, c.opts.TagCase)
+	if !c.opts.NoColorTags {
+		if tag := colorTag(note.Color, namespace+c.opts.ColorTagPrefix); tag != "" {
+			hashtags = strings.TrimSpace(hashtags + " " + tag)
+		}
+	}
+
+	if note.IsPinned && c.opts.PinnedTag != "" {
+		hashtags = strings.TrimSpace(hashtags + " #" + namespace + strings.TrimPrefix(c.opts.PinnedTag, "#"))
+	}
+
+	// Derive tags from the folders the note is nested in
+	if c.opts.FoldersAsTags {
+		hashtags = strings.TrimSpace(hashtags + " " + folderTags(folderPath, filePath, namespace))
+	}
+
+	// Append the content hash marker after the label hashtags
+	if c.opts.EmbedContentHash {
+		hashtags = strings.TrimSpace(hashtags + " #h_" + contentHash(note))
+	}
+	if c.opts.IdempotencyMarkers {
+		hashtags = strings.TrimSpace(hashtags + " " + noteMarker(note))
+	}
+
+	return hashtags
+}
+
+// buildTitle builds the Dynalist item title for a note from its base title,
+// adding the prefix and, unless they go in the note body, hashtags
+func (c *Converter) buildTitle(baseTitle string, note *KeepNote, folderPath string, filePath string) string {
+	title := c.opts.TitlePrefix + c.uniqueTitle(baseTitle, note, filePath)
+	if hashtags := c.buildHashtags(note, folderPath, filePath); hashtags != "" && c.opts.TagsPosition == TagsPositionTitle {
+		title += " " + hashtags
+	}
+
+	return title
+}
+
+// Supported ways of telling apart notes with the same title
+const (
+	UniqueTitlesDate    = "date"    // Append the creation date, then a counter if that is taken too or unknown
+	UniqueTitlesCounter = "counter" // Append (2), (3), ...
+)
+
+// validateUniqueTitles checks that the title disambiguation mode is supported
+func validateUniqueTitles(mode string) error {
+	switch mode {
+	case "", UniqueTitlesDate, UniqueTitlesCounter:
+		return nil
+	default:
+		return fmt.Errorf("invalid unique titles mode %q (use date or counter)", mode)
+	}
+}
+
+// uniqueTitle returns title, or with UniqueTitles set and title already given
+// to another note in this run, title with a date or counter appended. The first
+// note keeps the plain title, and a retried note keeps the title it got before.
+func (c *Converter) uniqueTitle(title string, note *KeepNote, filePath string) string {
+	if c.opts.UniqueTitles == "" {
+		return title
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if unique, ok := c.noteTitles[filePath]; ok {
+		return unique
+	}
+
+	base := title
+	if c.usedTitles[base] && c.opts.UniqueTitles == UniqueTitlesDate && note.CreatedTimestampUsec != 0 {
+		base = fmt.Sprintf("%s (%s)", title, usecToTime(note.CreatedTimestampUsec, c.opts.Location).Format(time.DateOnly))
+	}
+	unique := base
+	for n := 2; c.usedTitles[unique]; n++ {
+		unique = fmt.Sprintf("%s (%d)", base, n)
+	}
+
+	c.usedTitles[unique] = true
+	c.noteTitles[filePath] = unique
+	return unique
+}
+
+// buildBaseTitle returns the note's own title, or one derived from its file name
+// and content preview for untitled notes
+func (c *Converter) buildBaseTitle(note *KeepNote, filePath string) string {
+	title := note.Title
+	if title == "" && c.opts.PreferHTMLTitle {
+		title = htmlTitle(note.TextContentHTML)
+	}
+	if title == "" {
+		title = contentTitle(note, c.opts.ContentTitleLength)
+	}
+	if title == "" {
+		// Only notes without any text are titled with their file name
+		title = shortenFilename(filePath, c.opts.FilenameTitleLength)
+	}
+
+	return title
+}
@@ -0,0 +1,285 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeUploader records the files it is asked to upload, their metadata and how
+// many uploads ran at the same time, returning links below https://media.example/
+type fakeUploader struct {
+	delay time.Duration // How long each upload takes
+
+	mu       sync.Mutex
+	files    []string            // Base names of the uploaded files
+	metadata []map[string]string // Object metadata of each uploaded file
+	running  int
+	peak     int // Most uploads running at once
+}
+
+func (u *fakeUploader) upload(filePath string, name string, metadata map[string]string) (string, error) {
+	u.mu.Lock()
+	u.files = append(u.files, filepath.Base(filePath))
+	u.metadata = append(u.metadata, metadata)
+	u.running++
+	u.peak = max(u.peak, u.running)
+	u.mu.Unlock()
+
+	time.Sleep(u.delay)
+
+	u.mu.Lock()
+	u.running--
+	u.mu.Unlock()
+	return u.ObjectURL(name), nil
+}
+
+func (u *fakeUploader) UploadLocalFile(ctx context.Context, filePath string, metadata map[string]string) (string, error) {
+	return u.upload(filePath, filepath.Base(filePath), metadata)
+}
+
+func (u *fakeUploader) UploadLocalFileAs(ctx context.Context, filePath string, objectKey string, metadata map[string]string) (string, error) {
+	return u.upload(filePath, objectKey, metadata)
+}
+
+func (u *fakeUploader) UploadFile(ctx context.Context, fileData []byte, fileExt string) (string, error) {
+	return u.ObjectURL("upload" + fileExt), nil
+}
+
+func (u *fakeUploader) ObjectURL(objectKey string) string {
+	return "https://media.example/" + objectKey
+}
+
+// writeNoteFile writes a Keep note with the given JSON to the folder
+func writeNoteFile(t *testing.T, folder string, name string, note string) {
+	t.Helper()
+	if err := os.WriteFile(filepath.Join(folder, name), []byte(note), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestAttachmentNoteWorkers(t *testing.T) {
+	const notes = 12
+	takeout := t.TempDir()
+	for i := range notes {
+		image := fmt.Sprintf("image-%02d.png", i)
+		writeNoteFile(t, takeout, fmt.Sprintf("photo-%02d.json", i), fmt.Sprintf(`{"title":"Photo %d","attachments":[{"filePath":%q,"mimetype":"image/png"}],"createdTimestampUsec":1711391361446000}`, i, image))
+		writeNoteFile(t, takeout, image, fmt.Sprintf("image %d", i))
+		writeNoteFile(t, takeout, fmt.Sprintf("text-%02d.json", i), fmt.Sprintf(`{"title":"Text %d","textContent":"Text","createdTimestampUsec":1711391361446000}`, i))
+	}
+
+	uploader := &fakeUploader{delay: 20 * time.Millisecond}
+	c := newQuietConverter(t, Options{OutDir: t.TempDir(), Workers: 8, AttachmentNoteWorkers: 2, Uploader: uploader, Quiet: true})
+	if err := c.ProcessFolder(context.Background(), takeout); err != nil {
+		t.Fatalf("ProcessFolder() error = %v", err)
+	}
+
+	if got := c.Stats().Progress.ProcessedNotes; got != 2*notes {
+		t.Errorf("processed %d notes, want %d", got, 2*notes)
+	}
+	if len(uploader.files) != notes {
+		t.Errorf("uploaded %d attachments, want %d", len(uploader.files), notes)
+	}
+	if uploader.peak > 2 {
+		t.Errorf("%d notes with attachments ran at once, want at most 2", uploader.peak)
+	}
+}
+
+func TestNewRejectsNegativeAttachmentNoteWorkers(t *testing.T) {
+	if _, err := New(Options{AttachmentNoteWorkers: -1}); err == nil {
+		t.Error("New() error = nil, want an error for negative attachment note workers")
+	}
+}
+
+func TestProcessFolderAttachmentMetadata(t *testing.T) {
+	takeout := t.TempDir()
+	writeNoteFile(t, takeout, "Photo note.json", `{"title":"Photo","attachments":[{"filePath":"photo.png","mimetype":"image/png"}],"createdTimestampUsec":1711391361446000,"userEditedTimestampUsec":1711478400000000}`)
+	writeNoteFile(t, takeout, "photo.png", "image")
+
+	uploader := &fakeUploader{}
+	c := newQuietConverter(t, Options{OutDir: t.TempDir(), Uploader: uploader, Quiet: true})
+	if err := c.ProcessFolder(context.Background(), takeout); err != nil {
+		t.Fatalf("ProcessFolder() error = %v", err)
+	}
+
+	if len(uploader.metadata) != 1 {
+		t.Fatalf("uploaded %d attachments, want 1", len(uploader.metadata))
+	}
+	want := map[string]string{
+		"created":     "2024-03-25T18:29:21Z",
+		"edited":      "2024-03-26T18:40:00Z",
+		"source-note": "Photo%20note.json",
+		"run-id":      c.RunID(),
+	}
+	for key, value := range want {
+		if got := uploader.metadata[0][key]; got != value {
+			t.Errorf("metadata[%q] = %q, want %q", key, got, value)
+		}
+	}
+	if c.RunID() == "" {
+		t.Error("RunID() is empty, want an ID identifying the run")
+	}
+}
+
+func TestProcessFolderWebclipThumbnail(t *testing.T) {
+	const thumbnail = "1f2e3d4c5b6.a7b8c9d0e1f2a3b4.png"
+	server := newDocumentServer(t)
+	uploader := &fakeUploader{}
+	c := newQuietConverter(t, Options{
+		Token:      "test-token",
+		APIBaseURL: server.URL,
+		Retry:      testRetryConfig,
+		DocID:      "doc",
+		Uploader:   uploader,
+		Quiet:      true,
+	})
+	if err := c.ProcessFolder(context.Background(), filepath.Join("testdata", "webclip")); err != nil {
+		t.Fatalf("ProcessFolder() error = %v", err)
+	}
+
+	if len(uploader.files) != 1 || uploader.files[0] != thumbnail {
+		t.Fatalf("uploaded %v, want the thumbnail %s", uploader.files, thumbnail)
+	}
+	if len(server.changes) != 1 {
+		t.Fatalf("server received %d nodes, want 1", len(server.changes))
+	}
+	want := "Links:\n" +
+		"[Paella valenciana](https://recipes.example/paella) - A classic Valencian paella with chicken, rabbit and green beans.\n" +
+		"![Paella valenciana](https://media.example/" + thumbnail + ")"
+	if note := server.changes[0].Note; !strings.Contains(note, want) {
+		t.Errorf("note = %q, want it to contain %q", note, want)
+	}
+}
+
+func TestProcessFolderNoteArray(t *testing.T) {
+	folder := filepath.Join("testdata", "array")
+	statePath := filepath.Join(t.TempDir(), "state.txt")
+
+	// run migrates the fixture with the state file and returns the server's nodes
+	run := func() (ProgressStats, []dynalistChange) {
+		t.Helper()
+		state, err := OpenStateFile(statePath)
+		if err != nil {
+			t.Fatalf("OpenStateFile() error = %v", err)
+		}
+		defer state.Close()
+
+		server := newDocumentServer(t)
+		c := newQuietConverter(t, Options{Token: "test-token", APIBaseURL: server.URL, Retry: testRetryConfig, DocID: "doc", Workers: 2, State: state, Quiet: true})
+		if err := c.ProcessFolder(context.Background(), folder); err != nil {
+			t.Fatalf("ProcessFolder() error = %v", err)
+		}
+		return c.Stats().Progress, server.changes
+	}
+
+	// Every note of the array becomes its own node, with its checklist below it
+	progress, changes := run()
+	if progress.TotalNotes != 3 || progress.ProcessedNotes != 3 {
+		t.Fatalf("processed %d of %d notes, want 3 of 3", progress.ProcessedNotes, progress.TotalNotes)
+	}
+	var titles []string
+	for _, change := range changes {
+		if change.ParentID == "root" {
+			title, _, _ := strings.Cut(change.Content, " ")
+			titles = append(titles, title)
+		}
+	}
+	sort.Strings(titles)
+	if want := []string{"Chores", "Groceries", "Ideas"}; strings.Join(titles, ",") != strings.Join(want, ",") {
+		t.Errorf("notes = %q, want %q", titles, want)
+	}
+
+	// The state file records each note of the array, so a re-run skips them all
+	if progress, changes := run(); progress.TotalNotes != 0 || progress.ResumedNotes != 3 || len(changes) != 0 {
+		t.Errorf("second run had %d notes to do, resumed %d and sent %d nodes, want 0, 3 and 0", progress.TotalNotes, progress.ResumedNotes, len(changes))
+	}
+}
+
+func TestProcessFolderOutDirFormatting(t *testing.T) {
+	takeout := t.TempDir()
+	writeNoteFile(t, takeout, "note.json", `{"title":"Groceries","textContent":"Milk and eggs","createdTimestampUsec":1711391361446000}`)
+
+	script := filepath.Join(t.TempDir(), "transform.sh")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\ncat >/dev/null\necho '{\"title\":\"Shopping\",\"content\":\"Bread\"}'\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		opts Options
+		file string // Name of the written Markdown file
+		want string
+	}{
+		{"default", Options{}, "Groceries.md", "# Groceries\n\nMilk and eggs\n"},
+		{"transform", Options{TransformCmd: script}, "Shopping.md", "# Shopping\n\nBread\n"},
+		{"swap", Options{FieldMapping: FieldMappingSwap}, "Milk and eggs.md", "# Milk and eggs\n\nGroceries\n"},
+		{"merged", Options{FieldMapping: FieldMappingMerged}, "Groceries.md", "# Groceries\n\nMilk and eggs\n"},
+		{"transform and swap", Options{TransformCmd: script, FieldMapping: FieldMappingSwap}, "Bread.md", "# Bread\n\nShopping\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := tt.opts
+			opts.OutDir = t.TempDir()
+			opts.NoTimestamps = true
+			opts.Quiet = true
+			c := newQuietConverter(t, opts)
+			if err := c.ProcessFolder(context.Background(), takeout); err != nil {
+				t.Fatalf("ProcessFolder() error = %v", err)
+			}
+
+			got, err := os.ReadFile(filepath.Join(opts.OutDir, tt.file))
+			if err != nil {
+				entries, _ := os.ReadDir(opts.OutDir)
+				t.Fatalf("Markdown file not written: %v, out dir has %v", err, entries)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Markdown file = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadPreviousExportMaxFileSize(t *testing.T) {
+	previous := t.TempDir()
+	oversized, err := os.ReadFile(filepath.Join("testdata", "oversized.json")) // About 4 KB
+	if err != nil {
+		t.Fatal(err)
+	}
+	writeNoteFile(t, previous, "oversized.json", string(oversized))
+	writeNoteFile(t, previous, "small.json", `{"title":"Small","textContent":"Text"}`)
+
+	for _, tt := range []struct {
+		maxFileSize int64
+		wantKnown   bool
+	}{
+		{1024, false},
+		{-1, true},
+	} {
+		c := newQuietConverter(t, Options{MaxFileSize: tt.maxFileSize})
+		if err := c.LoadPreviousExport(previous); err != nil {
+			t.Fatalf("LoadPreviousExport() error = %v", err)
+		}
+		if !c.previous.isKnown("small.json") {
+			t.Errorf("with -max-file-size %d, small.json not known from the previous export", tt.maxFileSize)
+		}
+		if got := c.previous.isKnown("oversized.json"); got != tt.wantKnown {
+			t.Errorf("with -max-file-size %d, oversized.json known = %v, want %v", tt.maxFileSize, got, tt.wantKnown)
+		}
+	}
+}
+
+func TestNewDrawsProgressOnStderr(t *testing.T) {
+	c, err := New(Options{})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if c.opts.ProgressOutput != os.Stderr {
+		t.Errorf("ProgressOutput = %v, want os.Stderr", c.opts.ProgressOutput)
+	}
+}
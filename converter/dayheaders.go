@@ -0,0 +1,54 @@
+package converter
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"math"
+	"slices"
+	"time"
+)
+
+// dayHeader returns the title of the header node introducing a day's notes
+func dayHeader(day string) string {
+	return "— " + day + " —"
+}
+
+// sortByCreated orders note files by the creation time of their notes, oldest
+// first, for DayHeaders. Files that can't be read, and files holding an array
+// of notes, which keep the order of the array, go at the end.
+func (c *Converter) sortByCreated(files []noteFile) {
+	created := make(map[string]int64, len(files))
+	for _, file := range files {
+		note, err := c.parseKeepNote(file.path, c.opts.MaxFileSize)
+		if err != nil {
+			created[file.path] = math.MaxInt64
+			continue
+		}
+		created[file.path] = note.CreatedTimestampUsec
+	}
+	slices.SortStableFunc(files, func(a, b noteFile) int {
+		return cmp.Compare(created[a.path], created[b.path])
+	})
+}
+
+// addDayHeader adds a header node to the target document before the first note
+// of each day. Notes are processed one at a time with DayHeaders, so the header
+// always lands right before the note.
+func (c *Converter) addDayHeader(ctx context.Context, note *KeepNote, retry RetryConfig) error {
+	if note.CreatedTimestampUsec == 0 {
+		return nil // No day to go by
+	}
+	day := usecToTime(note.CreatedTimestampUsec, c.opts.Location).Format(time.DateOnly)
+	if day == c.lastDay {
+		return nil
+	}
+
+	if c.opts.DryRun {
+		log.Printf("[dry-run] day header %q", dayHeader(day))
+	} else if _, err := c.addToDocument(ctx, c.opts.DocID, c.parentID, dayHeader(day), "", false, false, 0, retry); err != nil {
+		return err
+	}
+	c.lastDay = day
+	return nil
+}
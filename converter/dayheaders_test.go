@@ -0,0 +1,51 @@
+package converter
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessFolderDayHeaders(t *testing.T) {
+	takeout := t.TempDir()
+	// Named so that the file order differs from the creation order
+	writeNoteFile(t, takeout, "a.json", `{"title":"Tuesday","createdTimestampUsec":1711447200000000}`)
+	writeNoteFile(t, takeout, "b.json", `{"title":"Monday-morning","createdTimestampUsec":1711357200000000}`)
+	writeNoteFile(t, takeout, "c.json", `{"title":"Monday-evening","createdTimestampUsec":1711389600000000}`)
+	writeNoteFile(t, takeout, "d.json", `{"title":"Wednesday","createdTimestampUsec":1711582200000000}`)
+
+	server := newDocumentServer(t)
+	c := newQuietConverter(t, Options{
+		Token:      "test-token",
+		APIBaseURL: server.URL,
+		Retry:      testRetryConfig,
+		DocID:      "doc",
+		DayHeaders: true,
+		Location:   time.UTC,
+		Workers:    4, // Day headers still add one note at a time
+		BatchSize:  4,
+		Quiet:      true,
+	})
+	if err := c.ProcessFolder(context.Background(), takeout); err != nil {
+		t.Fatalf("ProcessFolder() error = %v", err)
+	}
+
+	var got []string
+	for _, change := range server.changes {
+		title, _, _ := strings.Cut(change.Content, " #")
+		got = append(got, title)
+	}
+	want := []string{
+		"— 2024-03-25 —", "Monday-morning", "Monday-evening",
+		"— 2024-03-26 —", "Tuesday",
+		"— 2024-03-27 —", "Wednesday",
+	}
+	if strings.Join(got, "\n") != strings.Join(want, "\n") {
+		t.Errorf("nodes = %q, want %q", got, want)
+	}
+
+	if _, err := New(Options{DayHeaders: true}); err == nil {
+		t.Error("New() error = nil, want an error for day headers without a document ID")
+	}
+}
@@ -0,0 +1,85 @@
+package converter
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+)
+
+// uploadCache remembers the URL of every attachment uploaded in a run, so a
+// file attached to several notes is uploaded at most once and they all link the
+// same object. Files are identified by the SHA-256 of their contents.
+type uploadCache struct {
+	mu      sync.Mutex
+	entries map[string]*uploadCacheEntry
+}
+
+// uploadCacheEntry memoizes the URL of one uploaded file. Its lock is held during
+// the upload so concurrent workers wait for it instead of uploading the file again.
+type uploadCacheEntry struct {
+	mu  sync.Mutex
+	url string
+}
+
+// newUploadCache returns an empty upload cache
+func newUploadCache() *uploadCache {
+	return &uploadCache{entries: make(map[string]*uploadCacheEntry)}
+}
+
+// upload returns the memoized URL for key, reporting it as a hit, or runs the
+// upload and remembers its URL. Failed uploads are not remembered so they can
+// be retried.
+func (u *uploadCache) upload(key string, upload func() (string, error)) (url string, hit bool, err error) {
+	u.mu.Lock()
+	entry, ok := u.entries[key]
+	if !ok {
+		entry = &uploadCacheEntry{}
+		u.entries[key] = entry
+	}
+	u.mu.Unlock()
+
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	if entry.url != "" {
+		return entry.url, true, nil
+	}
+
+	url, err = upload()
+	if err != nil {
+		return "", false, err
+	}
+	entry.url = url
+	return url, false, nil
+}
+
+// uploadKey identifies an attachment in the upload cache. With RenameAttachments
+// the object name is part of the key, so every note still gets its attachment
+// under the name it was given and only re-uploads of that name are avoided.
+func (c *Converter) uploadKey(localFile string, name string) (string, error) {
+	hash, err := fileHash(localFile)
+	if err != nil {
+		return "", err
+	}
+	if c.opts.RenameAttachments {
+		return hash + "\x00" + name, nil
+	}
+	return hash, nil
+}
+
+// fileHash returns the hex SHA-256 of a file's contents
+func fileHash(filePath string) (string, error) {
+	file, err := os.Open(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,511 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	dynalistInboxPath    = "/inbox/add"
+	dynalistDocPath      = "/doc/edit"
+	dynalistFileListPath = "/file/list"
+	dynalistReadPath     = "/doc/read"
+	maxRetries           = 5                // Default maximum number of retries
+	minDelay             = 2 * time.Second  // Default minimum delay between retries
+	maxDelay             = 60 * time.Second // Default maximum delay between retries
+	minPause             = 1 * time.Second  // Default minimum random pause between API calls
+	maxPause             = 3 * time.Second  // Default maximum random pause between API calls
+	pacerStreak          = 5                // Successful calls needed before the pause shrinks
+)
+
+// DefaultAPIBaseURL is the root of the Dynalist API, used unless
+// Options.APIBaseURL points elsewhere, e.g. at a fake server in tests
+const DefaultAPIBaseURL = "https://dynalist.io/api/v1"
+
+// dynalistRequest represents the request body for the Dynalist API
+type dynalistRequest struct {
+	Token    string `json:"token"`
+	Index    int    `json:"index,omitempty"`
+	Content  string `json:"content"`        // Item text, i.e. the note title
+	Note     string `json:"note,omitempty"` // Text shown below the item, i.e. the note body
+	Checked  bool   `json:"checked,omitempty"`
+	Checkbox bool   `json:"checkbox,omitempty"`
+}
+
+// dynalistEditRequest represents the request body for the Dynalist document edit API
+type dynalistEditRequest struct {
+	Token   string           `json:"token"`
+	FileID  string           `json:"file_id"`
+	Changes []dynalistChange `json:"changes"`
+}
+
+// dynalistReadRequest represents the request body for the Dynalist document read API
+type dynalistReadRequest struct {
+	Token  string `json:"token"`
+	FileID string `json:"file_id"`
+}
+
+// dynalistNode is a node of a Dynalist document as returned by the read API
+type dynalistNode struct {
+	ID      string `json:"id"`
+	Content string `json:"content"`
+	Note    string `json:"note"`
+}
+
+// dynalistChange is a single change in a document edit request
+type dynalistChange struct {
+	Action   string `json:"action"`
+	ParentID string `json:"parent_id,omitempty"`
+	Index    int    `json:"index"`
+	Content  string `json:"content"`
+	Note     string `json:"note,omitempty"`
+	Checked  bool   `json:"checked,omitempty"`
+	Checkbox bool   `json:"checkbox,omitempty"`
+	Color    int    `json:"color,omitempty"` // 1 to 6 for red to purple, 0 for none
+}
+
+// dynalistResponse represents the response from the Dynalist API
+type dynalistResponse struct {
+	Code    string `json:"_code"`
+	Message string `json:"_msg,omitempty"`
+	FileID  string `json:"file_id,omitempty"`
+	NodeID  string `json:"node_id,omitempty"`
+	Index   int    `json:"index,omitempty"`
+
+	NewNodeIDs []string       `json:"new_node_ids,omitempty"` // Nodes inserted by a document edit
+	Nodes      []dynalistNode `json:"nodes,omitempty"`        // Nodes of a read document
+}
+
+// RetryConfig controls how Dynalist API calls are paced and retried
+type RetryConfig struct {
+	MaxRetries int
+	MinDelay   time.Duration
+	MaxDelay   time.Duration
+	MinPause   time.Duration
+	MaxPause   time.Duration
+	Rate       int // Calls per minute shared by all workers, replacing the random pause; 0 to keep it
+}
+
+// DefaultRetryConfig returns the built-in retry and pacing settings
+func DefaultRetryConfig() RetryConfig {
+	return RetryConfig{
+		MaxRetries: maxRetries,
+		MinDelay:   minDelay,
+		MaxDelay:   maxDelay,
+		MinPause:   minPause,
+		MaxPause:   maxPause,
+	}
+}
+
+// Validate checks that the retry settings are consistent
+func (c RetryConfig) Validate() error {
+	if c.MaxRetries < 0 {
+		return fmt.Errorf("max retries must not be negative, got %d", c.MaxRetries)
+	}
+	if c.MinDelay < 0 {
+		return fmt.Errorf("min delay must not be negative, got %s", c.MinDelay)
+	}
+	if c.MinDelay > c.MaxDelay {
+		return fmt.Errorf("min delay (%s) must not be greater than max delay (%s)", c.MinDelay, c.MaxDelay)
+	}
+	if c.MinPause > c.MaxPause {
+		return fmt.Errorf("min pause (%s) must not be greater than max pause (%s)", c.MinPause, c.MaxPause)
+	}
+	if c.Rate < 0 {
+		return fmt.Errorf("rate must not be negative, got %d", c.Rate)
+	}
+	return nil
+}
+
+// RetryStats counts the Dynalist API calls of a run
+type RetryStats struct {
+	TotalCalls      int
+	SuccessfulCalls int
+	FailedCalls     int
+	Retries         int
+	LastError       string
+	LastStatus      string
+	PauseCeiling    time.Duration // Current upper bound of the pause between calls
+}
+
+// pacer adapts the random pause between API calls to recent API health:
+// a streak of successes shrinks the pause toward MinPause while failures
+// grow it toward MaxDelay. With a Rate it instead hands out evenly spaced
+// call slots, so all workers together stay within the rate.
+type pacer struct {
+	mu            sync.Mutex
+	config        RetryConfig
+	ceiling       time.Duration
+	successStreak int
+	nextSlot      time.Time // Earliest time of the next call when a Rate is set
+}
+
+// newPacer creates a pacing controller starting at the configured maximum pause
+func newPacer(config RetryConfig) *pacer {
+	return &pacer{config: config, ceiling: config.MaxPause}
+}
+
+// pause returns how long to wait before the next API call
+func (p *pacer) pause() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.config.Rate > 0 {
+		now := time.Now()
+		slot := now
+		if p.nextSlot.After(now) {
+			slot = p.nextSlot
+		}
+		p.nextSlot = slot.Add(time.Minute / time.Duration(p.config.Rate))
+		return slot.Sub(now)
+	}
+
+	if p.ceiling <= p.config.MinPause {
+		return p.config.MinPause
+	}
+	return p.config.MinPause + time.Duration(rand.Int63n(int64(p.ceiling-p.config.MinPause)))
+}
+
+// success records a successful API call and returns the new pause ceiling
+func (p *pacer) success() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.successStreak++
+	if p.successStreak >= pacerStreak {
+		p.successStreak = 0
+		p.ceiling = max(p.config.MinPause, p.ceiling*3/4)
+	}
+	return p.ceiling
+}
+
+// failure records a failed API attempt and returns the new pause ceiling
+func (p *pacer) failure() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.successStreak = 0
+	p.ceiling = min(p.config.MaxDelay, max(p.config.MinPause, p.ceiling*2))
+	return p.ceiling
+}
+
+// apiFailure records a failed API attempt with the pacer and in the statistics
+func (c *Converter) apiFailure() {
+	ceiling := c.pace.failure()
+	c.updateAPIStats(func(a *RetryStats) { a.PauseCeiling = ceiling })
+}
+
+// ErrInvalidToken is returned by CheckToken when Dynalist rejects the API token
+var ErrInvalidToken = errors.New("invalid Dynalist API token")
+
+// CheckToken makes a single lightweight authenticated request to verify the API
+// token. It returns ErrInvalidToken when Dynalist rejects the token, and other
+// errors for network or server problems that don't say anything about the token.
+func (c *Converter) CheckToken(ctx context.Context) error {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+
+	jsonData, err := json.Marshal(dynalistRequest{Token: c.opts.Token})
+	if err != nil {
+		return fmt.Errorf("failed to marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", c.opts.APIBaseURL+dynalistFileListPath, bytes.NewBuffer(jsonData))
+	if err != nil {
+		return fmt.Errorf("failed to create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("failed to send request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var dynalistResp dynalistResponse
+	if err := json.NewDecoder(resp.Body).Decode(&dynalistResp); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	switch dynalistResp.Code {
+	case "Ok":
+		return nil
+	case "InvalidToken", "Unauthorized":
+		return ErrInvalidToken
+	default:
+		return fmt.Errorf("dynalist API error: %s", dynalistResp.Code)
+	}
+}
+
+// addToDynalist sends a message to the Dynalist inbox with retry logic, optionally
+// as a checkbox item. The title becomes the item text and the body its note.
+// The response identifies the created node so children can be added under it.
+func (c *Converter) addToDynalist(ctx context.Context, title string, body string, checkbox bool, checked bool, retry RetryConfig) (*dynalistResponse, error) {
+	return c.postToDynalist(ctx, dynalistInboxPath, dynalistRequest{
+		Token:    c.opts.Token,
+		Content:  title,
+		Note:     body,
+		Checkbox: checkbox,
+		Checked:  checked,
+	}, retry)
+}
+
+// addToDocument adds a message under a parent node of a Dynalist document instead
+// of the inbox, the document's root node when parentID is empty. Like addToDynalist,
+// the response identifies the created node so children can be added under it.
+func (c *Converter) addToDocument(ctx context.Context, fileID string, parentID string, title string, body string, checkbox bool, checked bool, color int, retry RetryConfig) (*dynalistResponse, error) {
+	if parentID == "" {
+		parentID = "root"
+	}
+
+	nodeIDs, err := c.addChildrenToDynalist(ctx, fileID, parentID, []dynalistChange{{
+		Content:  title,
+		Note:     body,
+		Checkbox: checkbox,
+		Checked:  checked,
+		Color:    color,
+	}}, retry)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodeIDs) == 0 {
+		return nil, fmt.Errorf("dynalist API did not return the ID of the new node")
+	}
+	return &dynalistResponse{Code: "Ok", FileID: fileID, NodeID: nodeIDs[0]}, nil
+}
+
+// readDocument returns every node of a Dynalist document
+func (c *Converter) readDocument(ctx context.Context, fileID string, retry RetryConfig) ([]dynalistNode, error) {
+	resp, err := c.postToDynalist(ctx, dynalistReadPath, dynalistReadRequest{
+		Token:  c.opts.Token,
+		FileID: fileID,
+	}, retry)
+	if err != nil {
+		return nil, err
+	}
+	return resp.Nodes, nil
+}
+
+// addChildrenToDynalist appends nodes, in order, under a parent node of a Dynalist
+// document and returns the IDs of the new nodes
+func (c *Converter) addChildrenToDynalist(ctx context.Context, fileID string, parentID string, children []dynalistChange, retry RetryConfig) ([]string, error) {
+	for i := range children {
+		children[i].Action = "insert"
+		children[i].ParentID = parentID
+		children[i].Index = -1 // Append to the end to keep the given order
+	}
+
+	resp, err := c.postToDynalist(ctx, dynalistDocPath, dynalistEditRequest{
+		Token:   c.opts.Token,
+		FileID:  fileID,
+		Changes: children,
+	}, retry)
+	if err != nil {
+		return nil, err
+	}
+	return resp.NewNodeIDs, nil
+}
+
+// postToDynalist sends a request body to a Dynalist API endpoint, given by its
+// path below the API root, with retry logic. It gives up as soon as the context
+// is cancelled, including while waiting to retry.
+func (c *Converter) postToDynalist(ctx context.Context, path string, reqBody interface{}, retry RetryConfig) (*dynalistResponse, error) {
+	apiURL := c.opts.APIBaseURL + path
+
+	// Add random pause before API call to avoid rate limiting
+	if err := sleepContext(ctx, c.pace.pause()); err != nil {
+		return nil, err
+	}
+
+	// Marshal request body to JSON
+	jsonData, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	// Initialize retry variables
+	var lastErr error
+	retryCount := 0
+	c.updateAPIStats(func(a *RetryStats) { a.TotalCalls++ })
+
+	// Retry loop with exponential backoff
+	for retryCount <= retry.MaxRetries {
+		// Create HTTP request
+		req, err := http.NewRequestWithContext(ctx, "POST", apiURL, bytes.NewBuffer(jsonData))
+		if err != nil {
+			return nil, fmt.Errorf("failed to create request: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+
+		// Send request
+		client := &http.Client{}
+		resp, err := client.Do(req)
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		if err != nil {
+			lastErr = fmt.Errorf("failed to send request: %w", err)
+			c.apiFailure()
+			retryCount++
+			c.updateAPIStats(func(a *RetryStats) { a.LastError = lastErr.Error() })
+
+			// If we've reached max retries, break
+			if retryCount > retry.MaxRetries {
+				break
+			}
+			c.updateAPIStats(func(a *RetryStats) { a.Retries++ })
+
+			// Calculate backoff delay with jitter
+			delay := calculateBackoff(retryCount, retry)
+			if err := sleepContext(ctx, delay); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Make sure we close the response body
+		responseBody := resp.Body
+		defer responseBody.Close()
+
+		// Parse response
+		var dynalistResp dynalistResponse
+		if err := json.NewDecoder(responseBody).Decode(&dynalistResp); err != nil {
+			lastErr = fmt.Errorf("failed to decode response: %w", err)
+			c.apiFailure()
+			retryCount++
+			c.updateAPIStats(func(a *RetryStats) { a.LastError = lastErr.Error() })
+
+			// If we've reached max retries, break
+			if retryCount > retry.MaxRetries {
+				break
+			}
+			c.updateAPIStats(func(a *RetryStats) { a.Retries++ })
+
+			// Wait as long as the server asked, or back off with jitter
+			if err := sleepContext(ctx, retryDelay(resp, retryCount, retry)); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		// Check response code
+		if dynalistResp.Code == "Ok" {
+			// Success!
+			ceiling := c.pace.success()
+			c.updateAPIStats(func(a *RetryStats) {
+				a.SuccessfulCalls++
+				a.LastStatus = "Success"
+				a.PauseCeiling = ceiling
+			})
+			return &dynalistResp, nil
+		}
+
+		// Handle specific error codes
+		lastErr = fmt.Errorf("dynalist API error: %s", dynalistResp.Code)
+		if dynalistResp.Message != "" {
+			lastErr = fmt.Errorf("dynalist API error: %s", dynalistResp.Message)
+		}
+		c.updateAPIStats(func(a *RetryStats) { a.LastError = lastErr.Error() })
+		c.apiFailure()
+
+		// If not a rate limit error, we might not want to retry
+		if dynalistResp.Code != "TooManyRequests" && retryCount >= 2 {
+			break
+		}
+
+		// Increment retry counter
+		retryCount++
+
+		// If we've reached max retries, break
+		if retryCount > retry.MaxRetries {
+			break
+		}
+		c.updateAPIStats(func(a *RetryStats) { a.Retries++ })
+
+		// Wait as long as the server asked, or back off with jitter
+		if err := sleepContext(ctx, retryDelay(resp, retryCount, retry)); err != nil {
+			return nil, err
+		}
+	}
+
+	// If we get here, all retries failed
+	c.updateAPIStats(func(a *RetryStats) {
+		a.FailedCalls++
+		a.LastStatus = "Failed"
+	})
+	return nil, lastErr
+}
+
+// sleepContext waits for the given duration, returning early with the
+// context's error if it is cancelled first
+func sleepContext(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// retryDelay returns how long to wait before retrying: the duration requested by
+// the response's Retry-After header when present, otherwise the jittered backoff
+func retryDelay(resp *http.Response, retry int, config RetryConfig) time.Duration {
+	if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After"), time.Now()); ok {
+		return delay
+	}
+	return calculateBackoff(retry, config)
+}
+
+// parseRetryAfter parses a Retry-After header given either in seconds or as an HTTP date
+func parseRetryAfter(value string, now time.Time) (time.Duration, bool) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return 0, false
+	}
+
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0, false
+		}
+		return time.Duration(seconds) * time.Second, true
+	}
+
+	if date, err := http.ParseTime(value); err == nil {
+		return max(0, date.Sub(now)), true
+	}
+
+	return 0, false
+}
+
+// maxBackoffExponent caps the backoff exponent: MinDelay * 2^64 exceeds any
+// time.Duration, so higher retry counts can't make the delay any longer
+const maxBackoffExponent = 64
+
+// calculateBackoff calculates exponential backoff with jitter
+func calculateBackoff(retry int, config RetryConfig) time.Duration {
+	// Calculate exponential backoff: MinDelay * 2^retry, with the exponent capped
+	// so the result stays finite however many retries are configured
+	exponent := min(max(retry, 0), maxBackoffExponent)
+	backoff := float64(config.MinDelay) * math.Pow(2, float64(exponent))
+
+	// Add jitter: random value between 0.5 and 1.5 of the calculated backoff
+	jitter := 0.5 + rand.Float64()
+	backoff = backoff * jitter
+
+	// Cap at MaxDelay before converting, as larger values overflow time.Duration
+	if backoff >= float64(config.MaxDelay) {
+		return config.MaxDelay
+	}
+
+	return time.Duration(backoff)
+}
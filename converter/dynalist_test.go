@@ -0,0 +1,324 @@
+package converter
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// testRetryConfig retries quickly and without pauses, so tests run fast
+var testRetryConfig = RetryConfig{
+	MaxRetries: 2,
+	MinDelay:   time.Millisecond,
+	MaxDelay:   2 * time.Millisecond,
+}
+
+// newTestConverter returns a converter sending API calls to a fake Dynalist
+// server answering with the responses in order, repeating the last one. It
+// also returns how many requests the server received.
+func newTestConverter(t *testing.T, responses ...string) (*Converter, *atomic.Int32) {
+	t.Helper()
+
+	var calls atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := int(calls.Add(1))
+		io.WriteString(w, responses[min(n, len(responses))-1])
+	}))
+	t.Cleanup(server.Close)
+
+	c, err := New(Options{
+		Token:          "test-token",
+		APIBaseURL:     server.URL,
+		Retry:          testRetryConfig,
+		ProgressOutput: io.Discard,
+	})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return c, &calls
+}
+
+func TestAddToDynalistRetries(t *testing.T) {
+	const (
+		ok          = `{"_code":"Ok","file_id":"f","node_id":"n"}`
+		rateLimited = `{"_code":"TooManyRequests","_msg":"slow down"}`
+		malformed   = `{"_code":`
+	)
+
+	tests := []struct {
+		name      string
+		responses []string
+		wantErr   bool
+		wantCalls int32
+		want      RetryStats
+	}{
+		{
+			name:      "success on first try",
+			responses: []string{ok},
+			wantCalls: 1,
+			want:      RetryStats{TotalCalls: 1, SuccessfulCalls: 1, LastStatus: "Success"},
+		},
+		{
+			name:      "success after TooManyRequests",
+			responses: []string{rateLimited, ok},
+			wantCalls: 2,
+			want:      RetryStats{TotalCalls: 1, SuccessfulCalls: 1, Retries: 1, LastStatus: "Success", LastError: "dynalist API error: slow down"},
+		},
+		{
+			name:      "permanent failure after max retries",
+			responses: []string{rateLimited},
+			wantErr:   true,
+			wantCalls: 3,
+			want:      RetryStats{TotalCalls: 1, FailedCalls: 1, Retries: 2, LastStatus: "Failed", LastError: "dynalist API error: slow down"},
+		},
+		{
+			name:      "malformed JSON",
+			responses: []string{malformed},
+			wantErr:   true,
+			wantCalls: 3,
+			want:      RetryStats{TotalCalls: 1, FailedCalls: 1, Retries: 2, LastStatus: "Failed", LastError: "failed to decode response: unexpected EOF"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, calls := newTestConverter(t, tt.responses...)
+
+			resp, err := c.addToDynalist(context.Background(), "Title", "Body", false, false, testRetryConfig)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("addToDynalist() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && resp.NodeID != "n" {
+				t.Errorf("addToDynalist() node ID = %q, want %q", resp.NodeID, "n")
+			}
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("server received %d requests, want %d", got, tt.wantCalls)
+			}
+
+			got := c.Stats().API
+			got.PauseCeiling = 0 // Depends on the pacer, not the retry logic
+			if got != tt.want {
+				t.Errorf("RetryStats = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddToDynalistPayload(t *testing.T) {
+	var got map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != dynalistInboxPath {
+			t.Errorf("request path = %q, want %q", r.URL.Path, dynalistInboxPath)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&got); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		io.WriteString(w, `{"_code":"Ok"}`)
+	}))
+	defer server.Close()
+
+	c, err := New(Options{Token: "test-token", APIBaseURL: server.URL, Retry: testRetryConfig, ProgressOutput: io.Discard})
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	if _, err := c.addToDynalist(context.Background(), "The title", "The body", false, false, testRetryConfig); err != nil {
+		t.Fatalf("addToDynalist() error = %v", err)
+	}
+
+	want := map[string]any{"token": "test-token", "content": "The title", "note": "The body"}
+	for key, value := range want {
+		if got[key] != value {
+			t.Errorf("payload %s = %v, want %v", key, got[key], value)
+		}
+	}
+}
+
+func TestCalculateBackoff(t *testing.T) {
+	config := RetryConfig{MinDelay: time.Second, MaxDelay: 30 * time.Second}
+
+	for _, retry := range []int{64, 1000, 1 << 30, -1} {
+		for range 100 {
+			delay := calculateBackoff(retry, config)
+			if delay < 0 {
+				t.Fatalf("calculateBackoff(%d) = %v, want a non-negative delay", retry, delay)
+			}
+			if delay > config.MaxDelay {
+				t.Fatalf("calculateBackoff(%d) = %v, want at most %v", retry, delay, config.MaxDelay)
+			}
+			if retry > 0 && delay != config.MaxDelay {
+				t.Fatalf("calculateBackoff(%d) = %v, want %v", retry, delay, config.MaxDelay)
+			}
+		}
+	}
+
+	// The jitter keeps small retry counts between half and one and a half times the backoff
+	for range 100 {
+		if delay := calculateBackoff(1, config); delay < time.Second || delay > 3*time.Second {
+			t.Fatalf("calculateBackoff(1) = %v, want between 1s and 3s", delay)
+		}
+	}
+}
+
+func TestProcessFolderPassStats(t *testing.T) {
+	const (
+		ok          = `{"_code":"Ok","file_id":"f","node_id":"n"}`
+		rateLimited = `{"_code":"TooManyRequests","_msg":"slow down"}`
+	)
+	takeout := t.TempDir()
+	note := `{"title":"Note","textContent":"Text","createdTimestampUsec":1711391361446000,"userEditedTimestampUsec":1711391361446000}`
+	if err := os.WriteFile(filepath.Join(takeout, "note.json"), []byte(note), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// The first pass gives up after its retries, the retry pass succeeds
+	c, _ := newTestConverter(t, rateLimited, rateLimited, rateLimited, ok)
+	if err := c.ProcessFolder(context.Background(), takeout); err != nil {
+		t.Fatalf("ProcessFolder() error = %v", err)
+	}
+
+	stats := c.Stats()
+	first, second := stats.FirstPass, stats.RetryPass
+	if first.Migrated != 0 || first.Failed != 1 || first.API.FailedCalls != 1 || first.API.SuccessfulCalls != 0 {
+		t.Errorf("FirstPass = %+v, want 1 failed note and call", first)
+	}
+	if second.Migrated != 1 || second.Failed != 0 || second.API.SuccessfulCalls != 1 || second.API.FailedCalls != 0 {
+		t.Errorf("RetryPass = %+v, want 1 migrated note and successful call", second)
+	}
+	if stats.API.TotalCalls != 2 || stats.API.Retries != 2 {
+		t.Errorf("API = %+v, want 2 calls and 2 retries in total", stats.API)
+	}
+}
+
+// documentServer is a fake Dynalist API recording the document edits it
+// receives, answering every inserted node with a new ID n1, n2 and so on
+type documentServer struct {
+	URL string
+
+	mu      sync.Mutex
+	changes []dynalistChange // Inserted nodes, in order
+	nodes   int
+}
+
+func newDocumentServer(t *testing.T) *documentServer {
+	t.Helper()
+	d := &documentServer{}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != dynalistDocPath {
+			t.Errorf("request path = %q, want %q", r.URL.Path, dynalistDocPath)
+		}
+		var req dynalistEditRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("failed to decode request: %v", err)
+		}
+		d.mu.Lock()
+		resp := dynalistResponse{Code: "Ok"}
+		for _, change := range req.Changes {
+			d.nodes++
+			d.changes = append(d.changes, change)
+			resp.NewNodeIDs = append(resp.NewNodeIDs, fmt.Sprintf("n%d", d.nodes))
+		}
+		d.mu.Unlock()
+		json.NewEncoder(w).Encode(resp)
+	}))
+	t.Cleanup(server.Close)
+	d.URL = server.URL
+	return d
+}
+
+func TestProcessFolderLabelColors(t *testing.T) {
+	takeout := t.TempDir()
+	writeNoteFile(t, takeout, "1.json", `{"title":"Both","labels":[{"name":"Work"},{"name":"Urgent"}],"createdTimestampUsec":1711391361446000}`)
+	writeNoteFile(t, takeout, "2.json", `{"title":"Work","labels":[{"name":"work"}],"createdTimestampUsec":1711391361446000}`)
+	writeNoteFile(t, takeout, "3.json", `{"title":"Plain","labels":[{"name":"Home"}],"createdTimestampUsec":1711391361446000}`)
+
+	server := newDocumentServer(t)
+	c := newQuietConverter(t, Options{
+		Token:       "test-token",
+		APIBaseURL:  server.URL,
+		Retry:       testRetryConfig,
+		DocID:       "doc",
+		LabelColors: []LabelColor{{Label: "urgent", Color: "red"}, {Label: "Work", Color: "Blue"}},
+	})
+	if err := c.ProcessFolder(context.Background(), takeout); err != nil {
+		t.Fatalf("ProcessFolder() error = %v", err)
+	}
+
+	want := map[string]int{"Both": 1, "Work": 5, "Plain": 0}
+	if len(server.changes) != len(want) {
+		t.Fatalf("server received %d nodes, want %d", len(server.changes), len(want))
+	}
+	for _, change := range server.changes {
+		title, _, _ := strings.Cut(change.Content, " ")
+		if change.Color != want[title] {
+			t.Errorf("node %q has color %d, want %d", change.Content, change.Color, want[title])
+		}
+	}
+}
+
+func TestNewRejectsUnknownLabelColor(t *testing.T) {
+	if _, err := New(Options{LabelColors: []LabelColor{{Label: "urgent", Color: "pink"}}}); err == nil {
+		t.Error("New() error = nil, want an error for an unknown color")
+	}
+}
+
+func TestProcessFolderRootNode(t *testing.T) {
+	takeout := t.TempDir()
+	writeNoteFile(t, takeout, "1.json", `{"title":"Text","textContent":"Body","createdTimestampUsec":1711391361446000}`)
+	writeNoteFile(t, takeout, "2.json", `{"title":"List","listContent":[{"text":"Milk"},{"text":"Eggs","isChecked":true}],"createdTimestampUsec":1711391361446000}`)
+
+	for _, batchSize := range []int{1, 2} {
+		t.Run(fmt.Sprintf("batch size %d", batchSize), func(t *testing.T) {
+			server := newDocumentServer(t)
+			c := newQuietConverter(t, Options{
+				Token:      "test-token",
+				APIBaseURL: server.URL,
+				Retry:      testRetryConfig,
+				DocID:      "doc",
+				ParentNode: "parent",
+				RootNode:   "Keep Import",
+				Workers:    batchSize,
+				BatchSize:  batchSize,
+				Quiet:      true,
+			})
+			if err := c.ProcessFolder(context.Background(), takeout); err != nil {
+				t.Fatalf("ProcessFolder() error = %v", err)
+			}
+
+			// The root node comes first, under the parent node, and holds both
+			// notes, while checklist items stay below their own note
+			changes := server.changes
+			if len(changes) != 5 {
+				t.Fatalf("server received %d nodes, want 5: %+v", len(changes), changes)
+			}
+			if changes[0].Content != "Keep Import" || changes[0].ParentID != "parent" {
+				t.Fatalf("first node = %+v, want the root node under the parent node", changes[0])
+			}
+			parents := make(map[string]string) // Parent ID by the content of each node
+			ids := make(map[string]string)     // Content by node ID
+			for i, change := range changes {
+				title, _, _ := strings.Cut(change.Content, " ")
+				parents[title] = change.ParentID
+				ids[fmt.Sprintf("n%d", i+1)] = title
+			}
+			for title, parent := range map[string]string{"Text": "Keep", "List": "Keep", "Milk": "List", "Eggs": "List"} {
+				if got := ids[parents[title]]; got != parent {
+					t.Errorf("node %q is under %q, want %q", title, got, parent)
+				}
+			}
+		})
+	}
+
+	// Notes can't be gathered under a node without a document
+	if _, err := New(Options{RootNode: "Keep Import"}); err == nil {
+		t.Error("New() error = nil, want an error for a root node without a document ID")
+	}
+}
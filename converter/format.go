@@ -0,0 +1,43 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Formatter decides how a note's title and body are assigned to the content
+// and note of its Dynalist item. The title already carries the prefix and, if
+// they go there, the hashtags.
+type Formatter func(title string, body string) (content string, note string)
+
+// Supported assignments of Keep fields to Dynalist items
+const (
+	FieldMappingTitle  = "title"  // The title is the item, the text its note
+	FieldMappingSwap   = "swap"   // The text is the item, the title its note
+	FieldMappingMerged = "merged" // The title and text together are the item, without a note
+)
+
+// formatters maps field mapping names to their formatters
+var formatters = map[string]Formatter{
+	FieldMappingTitle: func(title string, body string) (string, string) {
+		return title, body
+	},
+	FieldMappingSwap: func(title string, body string) (string, string) {
+		if body == "" {
+			return title, "" // Don't add an empty item
+		}
+		return body, title
+	},
+	FieldMappingMerged: func(title string, body string) (string, string) {
+		return strings.TrimRight(title+"\n"+body, "\n"), ""
+	},
+}
+
+// lookupFormatter returns the formatter for a field mapping name
+func lookupFormatter(mapping string) (Formatter, error) {
+	formatter, ok := formatters[mapping]
+	if !ok {
+		return nil, fmt.Errorf("invalid field mapping %q (use title, swap or merged)", mapping)
+	}
+	return formatter, nil
+}
@@ -0,0 +1,48 @@
+package converter
+
+import (
+	"bytes"
+	"html/template"
+)
+
+// galleryItem is a single uploaded attachment shown on a gallery page
+type galleryItem struct {
+	Name  string
+	URL   string
+	Image bool // Shown inline; other files, e.g. PDFs or audio, are only linked
+}
+
+var galleryTemplate = template.Must(template.New("gallery").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>{{.Title}}</title>
+<style>
+body { font-family: sans-serif; margin: 2em; }
+figure { display: inline-block; margin: 0.5em; vertical-align: top; }
+img { max-width: 320px; max-height: 320px; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+{{range .Items}}<figure>
+{{if .Image}}<a href="{{.URL}}"><img src="{{.URL}}" alt="{{.Name}}"></a>{{else}}<a href="{{.URL}}">{{.Name}}</a>{{end}}
+<figcaption>{{.Name}}</figcaption>
+</figure>
+{{end}}</body>
+</html>
+`))
+
+// buildGalleryHTML renders a simple HTML page showing all attachments of a note
+func buildGalleryHTML(title string, items []galleryItem) []byte {
+	if title == "" {
+		title = "Attachments"
+	}
+
+	var buf bytes.Buffer
+	galleryTemplate.Execute(&buf, struct {
+		Title string
+		Items []galleryItem
+	}{title, items})
+	return buf.Bytes()
+}
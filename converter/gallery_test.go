@@ -0,0 +1,23 @@
+package converter
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildGalleryHTML(t *testing.T) {
+	page := string(buildGalleryHTML("Whiteboard", []galleryItem{
+		{Name: "board.jpg", URL: "https://media.example/board.jpg", Image: true},
+		{Name: "minutes.pdf", URL: "https://media.example/minutes.pdf"},
+	}))
+
+	if want := `<a href="https://media.example/board.jpg"><img src="https://media.example/board.jpg" alt="board.jpg"></a>`; !strings.Contains(page, want) {
+		t.Errorf("gallery page doesn't show the image inline with %q:\n%s", want, page)
+	}
+	if want := `<a href="https://media.example/minutes.pdf">minutes.pdf</a>`; !strings.Contains(page, want) {
+		t.Errorf("gallery page doesn't link the PDF with %q:\n%s", want, page)
+	}
+	if strings.Contains(page, `<img src="https://media.example/minutes.pdf"`) {
+		t.Errorf("gallery page shows the PDF as an image:\n%s", page)
+	}
+}
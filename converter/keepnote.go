@@ -0,0 +1,723 @@
+package converter
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html"
+	"io"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// KeepNote represents a Google Keep note from the takeout JSON
+type KeepNote struct {
+	Title                   string       `json:"title"`
+	TextContent             string       `json:"textContent"`
+	TextContentHTML         string       `json:"textContentHtml,omitempty"`
+	Attachments             []Attachment `json:"attachments,omitempty"`
+	Labels                  []Label      `json:"labels,omitempty"`
+	UserEditedTimestampUsec int64        `json:"userEditedTimestampUsec"`
+	CreatedTimestampUsec    int64        `json:"createdTimestampUsec"`
+	IsArchived              bool         `json:"isArchived"` // Add IsArchived field
+	IsTrashed               bool         `json:"isTrashed"`
+	IsPinned                bool         `json:"isPinned"`
+	Color                   string       `json:"color,omitempty"`
+	ListContent             []ListItem   `json:"listContent,omitempty"`
+	Annotations             []Annotation `json:"annotations,omitempty"`
+	Sharees                 []Sharee     `json:"sharees,omitempty"`
+	Reminders               []Reminder   `json:"reminders,omitempty"`
+	// Other fields...
+}
+
+type Attachment struct {
+	FilePath      string `json:"filePath"`
+	MimeType      string `json:"mimetype"`
+	ExtractedText string `json:"extractedText,omitempty"` // Text recognized in a drawing, when the export has it
+}
+
+// isDrawing reports whether Keep marks an attachment as a drawing rather than a photo
+func isDrawing(attachment Attachment) bool {
+	return strings.Contains(strings.ToLower(attachment.MimeType), "drawing")
+}
+
+// drawingText returns the text extracted from a note's drawings, one drawing
+// per paragraph, or "" when the export has none
+func drawingText(attachments []Attachment) string {
+	var texts []string
+	for _, attachment := range attachments {
+		if text := strings.TrimSpace(attachment.ExtractedText); text != "" && isDrawing(attachment) {
+			texts = append(texts, text)
+		}
+	}
+	return strings.Join(texts, "\n\n")
+}
+
+type Label struct {
+	Name string `json:"name"`
+}
+
+// Annotation is content Keep attached to a note, such as a captured web link
+type Annotation struct {
+	Description string `json:"description"`
+	Source      string `json:"source"` // e.g. "WEBLINK"
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Thumbnail   string `json:"thumbnailFilePath,omitempty"` // Preview image of a web clip, a file in the takeout
+
+	ThumbnailURL string `json:"-"` // Where the thumbnail was uploaded, shown inline in the links
+}
+
+// ListItem is a single entry of a Google Keep checklist note
+type ListItem struct {
+	Text      string `json:"text"`
+	IsChecked bool   `json:"isChecked"`
+}
+
+// ErrNotKeepNote is returned by parseKeepNote for .json files that aren't Keep
+// notes at all, such as empty files or HTML pages, as opposed to corrupt notes
+var ErrNotKeepNote = errors.New("not a Google Keep note")
+
+// DefaultMaxFileSize is the size above which note files are rejected instead of parsed
+const DefaultMaxFileSize = 32 * 1024 * 1024
+
+// errNoteArray is returned by parseKeepNote for files holding a JSON array of
+// notes, which are read element by element with streamNoteArray instead
+var errNoteArray = errors.New("file holds an array of notes")
+
+// parseKeepNote parses a Google Keep JSON file into a KeepNote struct, decoding
+// it as it is read. Files larger than maxSize bytes are rejected; 0 means no limit.
+func (c *Converter) parseKeepNote(filePath string, maxSize int64) (*KeepNote, error) {
+	file, err := c.openTakeoutFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+
+	// Keep notes are JSON objects, or arrays of them in single-file exports;
+	// anything else is some other file
+	reader := bufio.NewReader(file)
+	first, err := firstNonSpaceByte(reader)
+	if err == io.EOF {
+		return nil, fmt.Errorf("%w: empty file", ErrNotKeepNote)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file: %w", err)
+	}
+	if first == '[' {
+		return nil, errNoteArray
+	}
+	if first != '{' {
+		return nil, fmt.Errorf("%w: content is not a JSON object", ErrNotKeepNote)
+	}
+
+	if maxSize > 0 {
+		fileInfo, err := file.Stat()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file: %w", err)
+		}
+		if fileInfo.Size() > maxSize {
+			return nil, fmt.Errorf("file is %d bytes, larger than the %d byte limit", fileInfo.Size(), maxSize)
+		}
+	}
+
+	// Decode the JSON data
+	var note KeepNote
+	if err := json.NewDecoder(reader).Decode(&note); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+	return finishKeepNote(&note)
+}
+
+// streamNoteArray decodes a file holding a JSON array of Keep notes one element
+// at a time, so memory stays flat however large the file is, and calls fn with
+// each note and its position, counted from 1, until fn returns false. A note
+// that can't be decoded is passed with its error and ends the stream. It
+// reports whether the file holds an array at all; other files are left alone.
+// The array as a whole isn't subject to the file size limit.
+func (c *Converter) streamNoteArray(filePath string, fn func(element int, note *KeepNote, err error) bool) (bool, error) {
+	file, err := c.openTakeoutFile(filePath)
+	if err != nil {
+		return false, fmt.Errorf("failed to read file: %w", err)
+	}
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+	if first, err := firstNonSpaceByte(reader); err != nil || first != '[' {
+		return false, nil
+	}
+
+	decoder := json.NewDecoder(reader)
+	if _, err := decoder.Token(); err != nil { // The opening bracket
+		return true, fmt.Errorf("failed to unmarshal JSON: %w", err)
+	}
+	for element := 1; decoder.More(); element++ {
+		var note KeepNote
+		if err := decoder.Decode(&note); err != nil {
+			fn(element, nil, fmt.Errorf("failed to unmarshal JSON: %w", err))
+			return true, nil
+		}
+		parsed, err := finishKeepNote(&note)
+		if !fn(element, parsed, err) {
+			return true, nil
+		}
+	}
+	return true, nil
+}
+
+// countNoteArray returns how many notes a file holding a JSON array of notes
+// has, decoding one element at a time, or 0 for any other file. A broken
+// element is counted, so the note it was meant to be is reported when processed.
+func (c *Converter) countNoteArray(filePath string) int {
+	count := 0
+	c.streamNoteArray(filePath, func(int, *KeepNote, error) bool {
+		count++
+		return true
+	})
+	return count
+}
+
+// finishKeepNote fills in the plain text of notes that only have HTML content,
+// and rejects JSON objects without any Keep note fields
+func finishKeepNote(note *KeepNote) (*KeepNote, error) {
+	// Some notes only have HTML content
+	if note.TextContent == "" && note.TextContentHTML != "" {
+		note.TextContent = htmlToText(note.TextContentHTML)
+	}
+
+	// Every Keep note has timestamps, even when it has no content
+	if note.Title == "" && note.TextContent == "" && len(note.ListContent) == 0 && len(note.Attachments) == 0 &&
+		note.CreatedTimestampUsec == 0 && note.UserEditedTimestampUsec == 0 {
+		return nil, fmt.Errorf("%w: no Keep note fields", ErrNotKeepNote)
+	}
+	return note, nil
+}
+
+// firstNonSpaceByte returns the first byte of the reader that isn't white space,
+// leaving it unread
+func firstNonSpaceByte(reader *bufio.Reader) (byte, error) {
+	for {
+		b, err := reader.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		if !unicode.IsSpace(rune(b)) {
+			return b, reader.UnreadByte()
+		}
+	}
+}
+
+// processLabels converts Google Keep labels to Dynalist hashtags, renaming the
+// labels found in labelMap first and prepending namespace to each tag
+func processLabels(labels []Label, labelMap map[string]string, namespace string, separator string, tagCase string) string {
+	var hashtags []string
+	for _, label := range labels {
+		name := label.Name
+		if mapped, ok := labelMap[name]; ok {
+			name = mapped
+		}
+		tag := formatTag(name, separator, tagCase)
+		if tag == "" {
+			continue
+		}
+		// After a namespace a tag may start with a digit, so the guarding underscore isn't needed
+		if namespace != "" {
+			tag = strings.TrimPrefix(tag, "_")
+		}
+		hashtags = append(hashtags, "#"+namespace+tag)
+	}
+	return strings.Join(hashtags, " ")
+}
+
+// Supported ways of joining the words of a multi-word label
+const (
+	TagSeparatorUnderscore = "underscore" // "My Project" -> "My_Project"
+	TagSeparatorDash       = "dash"       // "My Project" -> "My-Project"
+	TagSeparatorCamel      = "camel"      // "My Project" -> "MyProject"
+	TagSeparatorRemove     = "remove"     // "My project" -> "Myproject"
+)
+
+// Supported casings for generated tags
+const (
+	TagCasePreserve = "preserve"
+	TagCaseLower    = "lower"
+	TagCaseUpper    = "upper"
+)
+
+// Supported places for a note's tags
+const (
+	TagsPositionTitle      = "title"       // After the item title
+	TagsPositionNoteTop    = "note-top"    // On the first line of the note body
+	TagsPositionNoteBottom = "note-bottom" // On the last line of the note body
+)
+
+// formatTag turns a label name into tag text (without the leading #) using
+// the given word separator and casing. Characters Dynalist doesn't allow in
+// tags separate words like spaces do, so "to/do" becomes "to_do" and "C#"
+// becomes "C". Tags that would start with a digit get a leading underscore.
+// It returns "" when nothing usable is left of the name.
+func formatTag(name string, separator string, tagCase string) string {
+	words := tagWords(name)
+	if len(words) == 0 {
+		return ""
+	}
+
+	switch tagCase {
+	case TagCaseLower:
+		for i := range words {
+			words[i] = strings.ToLower(words[i])
+		}
+	case TagCaseUpper:
+		for i := range words {
+			words[i] = strings.ToUpper(words[i])
+		}
+	}
+
+	var tag string
+	switch separator {
+	case TagSeparatorDash:
+		tag = strings.Join(words, "-")
+	case TagSeparatorCamel:
+		for i, word := range words {
+			runes := []rune(word)
+			runes[0] = unicode.ToUpper(runes[0])
+			words[i] = string(runes)
+		}
+		tag = strings.Join(words, "")
+	case TagSeparatorRemove:
+		tag = strings.Join(words, "")
+	default:
+		tag = strings.Join(words, "_")
+	}
+
+	if first, _ := utf8.DecodeRuneInString(tag); unicode.IsDigit(first) {
+		tag = "_" + tag
+	}
+	return tag
+}
+
+// tagWords splits a label name into the words of a tag. Letters (including
+// non-ASCII ones), digits, underscores and dashes are kept, anything else
+// separates words, and runs of underscores or dashes are collapsed.
+func tagWords(name string) []string {
+	fields := strings.FieldsFunc(name, func(r rune) bool { return !isTagRune(r) })
+
+	var words []string
+	for _, field := range fields {
+		field = repeatedSeparatorPattern.ReplaceAllStringFunc(field, func(run string) string {
+			return run[:1]
+		})
+		if field = strings.Trim(field, "_-"); field != "" {
+			words = append(words, field)
+		}
+	}
+	return words
+}
+
+// isTagRune reports whether a character is allowed in Dynalist tags
+func isTagRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r) || unicode.IsMark(r) || r == '_' || r == '-'
+}
+
+// repeatedSeparatorPattern matches runs of underscores or dashes in a tag word
+var repeatedSeparatorPattern = regexp.MustCompile(`__+|--+`)
+
+// validateTagFormat checks that the tag separator, casing and position are supported
+func validateTagFormat(separator string, tagCase string, position string) error {
+	switch separator {
+	case TagSeparatorUnderscore, TagSeparatorDash, TagSeparatorCamel, TagSeparatorRemove:
+	default:
+		return fmt.Errorf("invalid tag separator %q (use underscore, dash, camel or remove)", separator)
+	}
+	switch tagCase {
+	case TagCasePreserve, TagCaseLower, TagCaseUpper:
+	default:
+		return fmt.Errorf("invalid tag case %q (use preserve, lower or upper)", tagCase)
+	}
+	switch position {
+	case TagsPositionTitle, TagsPositionNoteTop, TagsPositionNoteBottom:
+	default:
+		return fmt.Errorf("invalid tags position %q (use title, note-top or note-bottom)", position)
+	}
+	return nil
+}
+
+// hasAnyLabel reports whether the note has at least one of the wanted labels,
+// ignoring case and surrounding whitespace
+func hasAnyLabel(note *KeepNote, wanted []string) bool {
+	for _, label := range note.Labels {
+		for _, name := range wanted {
+			if strings.EqualFold(strings.TrimSpace(label.Name), strings.TrimSpace(name)) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// isEmptyNote reports whether a note has nothing worth migrating: no title,
+// text, checklist items, attachments or annotations
+func isEmptyNote(note *KeepNote) bool {
+	return strings.TrimSpace(note.Title) == "" && strings.TrimSpace(note.TextContent) == "" &&
+		len(note.ListContent) == 0 && len(note.Attachments) == 0 && len(note.Annotations) == 0
+}
+
+// Sharee is a person a note is shared with, including its owner
+type Sharee struct {
+	Email   string `json:"email"`
+	IsOwner bool   `json:"isOwner"`
+	Type    string `json:"type"` // E.g. WRITER
+}
+
+// shareesLine formats who a note is shared with, or returns "" for unshared
+// notes. With redact the addresses are replaced by a short hash of each, so
+// the same person can still be recognized across notes.
+func shareesLine(sharees []Sharee, redact bool) string {
+	var names []string
+	for _, sharee := range sharees {
+		name := sharee.Email
+		if redact {
+			sum := sha256.Sum256([]byte(strings.ToLower(strings.TrimSpace(sharee.Email))))
+			name = "user-" + hex.EncodeToString(sum[:])[:8]
+		}
+		if sharee.IsOwner {
+			name += " (owner)"
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		return ""
+	}
+	return "Shared with: " + strings.Join(names, ", ")
+}
+
+// usecToTime converts a Keep timestamp, in microseconds since the Unix epoch
+// (UTC), to a time shown in the given location
+func usecToTime(usec int64, loc *time.Location) time.Time {
+	return time.UnixMicro(usec).In(loc)
+}
+
+// timestampFooter formats the note's created and last-edited dates for the note body
+func timestampFooter(note *KeepNote, layout string, loc *time.Location) string {
+	var lines []string
+	if note.CreatedTimestampUsec != 0 {
+		lines = append(lines, "Created: "+usecToTime(note.CreatedTimestampUsec, loc).Format(layout))
+	}
+	if note.UserEditedTimestampUsec != 0 {
+		lines = append(lines, "Edited: "+usecToTime(note.UserEditedTimestampUsec, loc).Format(layout))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// annotationLines formats a note's annotations as Markdown, one per line: links
+// with their title and description, other annotations with whatever text they have.
+// Uploaded web clip thumbnails follow their link as inline images.
+func annotationLines(annotations []Annotation) []string {
+	var lines []string
+	for _, annotation := range annotations {
+		text := strings.TrimSpace(annotation.Title)
+		if annotation.URL != "" {
+			if text == "" {
+				text = annotation.URL
+			}
+			text = fmt.Sprintf("[%s](%s)", text, annotation.URL)
+		}
+		if description := strings.TrimSpace(annotation.Description); description != "" {
+			text = strings.TrimSpace(text + " - " + description)
+		}
+		if text != "" {
+			lines = append(lines, text)
+		}
+		if annotation.ThumbnailURL != "" {
+			alt := strings.TrimSpace(annotation.Title)
+			if alt == "" {
+				alt = "Thumbnail"
+			}
+			lines = append(lines, fmt.Sprintf("![%s](%s)", alt, annotation.ThumbnailURL))
+		}
+	}
+	return lines
+}
+
+// colorTag converts a Google Keep note color to a Dynalist hashtag with the given prefix.
+// Most notes carry the "DEFAULT" color, which is treated as no color at all.
+func colorTag(color string, prefix string) string {
+	if color == "" || strings.EqualFold(color, "DEFAULT") {
+		return ""
+	}
+	return "#" + prefix + strings.ToLower(color)
+}
+
+// folderTags converts the folders between the takeout folder and a note file
+// into hashtags, e.g. "Projects/Alpha/note.json" becomes "#projects #alpha",
+// prepending namespace to each
+func folderTags(folderPath string, filePath string, namespace string) string {
+	relDir, err := filepath.Rel(folderPath, filepath.Dir(filePath))
+	if err != nil || relDir == "." {
+		return ""
+	}
+
+	var hashtags []string
+	for _, segment := range strings.Split(relDir, string(filepath.Separator)) {
+		tag := strings.ReplaceAll(slugify(segment), "-", "_")
+		if tag != "" {
+			hashtags = append(hashtags, "#"+namespace+tag)
+		}
+	}
+	return strings.Join(hashtags, " ")
+}
+
+// findAttachmentFile locates an attachment file in the takeout folder. When it
+// isn't at the recorded path, the folder tree is searched for a file with the
+// same name, preferring an exact match over one that only differs in case.
+func (c *Converter) findAttachmentFile(folderPath string, attachmentPath string) (string, error) {
+	attachmentFile := filepath.Join(folderPath, attachmentPath)
+	if _, err := c.statTakeoutFile(attachmentFile); err == nil {
+		return attachmentFile, nil
+	}
+
+	name := filepath.Base(attachmentPath)
+	candidates := c.attachmentIndex(folderPath)[strings.ToLower(name)]
+	for _, candidate := range candidates {
+		if filepath.Base(candidate) == name {
+			log.Printf("Attachment %s not at its recorded path, using %s", attachmentPath, candidate)
+			return candidate, nil
+		}
+	}
+	if len(candidates) > 0 {
+		log.Printf("Attachment %s not at its recorded path, using %s (name differs in case)", attachmentPath, candidates[0])
+		return candidates[0], nil
+	}
+	return "", fmt.Errorf("attachment file not found: %s", attachmentPath)
+}
+
+// attachmentIndex returns the files below a folder grouped by lowercase name,
+// walking the folder on first use. JSON note files are left out.
+func (c *Converter) attachmentIndex(folderPath string) map[string][]string {
+	c.indexesMu.Lock()
+	defer c.indexesMu.Unlock()
+
+	if index, ok := c.indexes[folderPath]; ok {
+		return index
+	}
+	index := make(map[string][]string)
+	c.walkTakeout(folderPath, func(filePath string, isDir bool) error {
+		if !isDir && filepath.Ext(filePath) != ".json" {
+			key := strings.ToLower(filepath.Base(filePath))
+			index[key] = append(index[key], filePath)
+		}
+		return nil
+	})
+	c.indexes[folderPath] = index
+	return index
+}
+
+// DefaultFilenameTitleLength is how many characters of a file name untitled notes are titled with
+const DefaultFilenameTitleLength = 15
+
+// DefaultContentTitleLength is how many characters of their first line untitled notes are titled with
+const DefaultContentTitleLength = 60
+
+// contentTitle returns the first non-empty line of a note's text, or of its
+// checklist, shortened to at most maxLen characters plus an ellipsis. It
+// returns "" for notes without any text.
+func contentTitle(note *KeepNote, maxLen int) string {
+	lines := strings.Split(note.TextContent, "\n")
+	for _, item := range note.ListContent {
+		lines = append(lines, item.Text)
+	}
+
+	for _, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		// Never split a multi-byte character
+		if runes := []rune(line); len(runes) > maxLen {
+			line = strings.TrimSpace(string(runes[:maxLen])) + "..."
+		}
+		return line
+	}
+	return ""
+}
+
+// shortenFilename shortens a filename for use as a title, to at most maxLen characters plus an ellipsis
+func shortenFilename(filename string, maxLen int) string {
+	name := filepath.Base(filename)
+	ext := filepath.Ext(filename)
+	base := strings.TrimSuffix(name, ext)
+
+	// Remove timestamp patterns often found in filenames
+	// Common formats: 2024-03-25T19_29_21.446+01_00
+	timestampPatterns := []string{
+		`\d{4}-\d{2}-\d{2}T\d{2}_\d{2}_\d{2}`,
+		`\d{4}-\d{2}-\d{2}`,
+		`\d{2}_\d{2}_\d{2}`,
+	}
+
+	for _, pattern := range timestampPatterns {
+		base = strings.Split(base, pattern)[0]
+	}
+
+	// Trim any leading/trailing special characters
+	base = strings.Trim(base, "._- ")
+
+	// Shorten to maxLen characters, never splitting a multi-byte character
+	if runes := []rune(base); len(runes) > maxLen {
+		base = string(runes[:maxLen]) + "..."
+	}
+
+	return base
+}
+
+// contentHash returns a short deterministic hash of the note's title and text,
+// used as a marker for detecting duplicates across runs and tools
+func contentHash(note *KeepNote) string {
+	text := note.Title + "\n" + note.TextContent
+	for _, item := range note.ListContent {
+		text += "\n" + item.Text
+	}
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])[:8]
+}
+
+// duplicateKey identifies a note's content for finding duplicates within a run,
+// e.g. the same note in two exports. Whitespace differences are ignored unless
+// keepWhitespace is set, and with timestamps the creation time must match too.
+func duplicateKey(note *KeepNote, keepWhitespace bool, timestamps bool) string {
+	parts := []string{note.Title, note.TextContent}
+	for _, item := range note.ListContent {
+		parts = append(parts, item.Text)
+	}
+	for _, attachment := range note.Attachments {
+		parts = append(parts, filepath.Base(attachment.FilePath))
+	}
+	if !keepWhitespace {
+		for i, part := range parts {
+			parts[i] = strings.Join(strings.Fields(part), " ")
+		}
+	}
+	if timestamps {
+		parts = append(parts, strconv.FormatInt(note.CreatedTimestampUsec, 10))
+	}
+	sum := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(sum[:])
+}
+
+// noteMarker returns a deterministic idempotency tag for a note, derived from its
+// creation time and body. The title is left out as untitled notes get one generated.
+func noteMarker(note *KeepNote) string {
+	text := fmt.Sprintf("%d\n%s", note.CreatedTimestampUsec, note.TextContent)
+	for _, item := range note.ListContent {
+		text += "\n" + item.Text
+	}
+	sum := sha256.Sum256([]byte(text))
+	return "#k_" + hex.EncodeToString(sum[:])[:10]
+}
+
+// noteMarkerPattern matches the idempotency tags generated by noteMarker
+var noteMarkerPattern = regexp.MustCompile(`#k_[0-9a-f]{10}\b`)
+
+// slugify converts text to a lowercase, dash-separated string safe for object keys
+func slugify(text string) string {
+	var b strings.Builder
+	lastDash := true
+	for _, r := range strings.ToLower(text) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+			lastDash = false
+		} else if !lastDash {
+			b.WriteRune('-')
+			lastDash = true
+		}
+	}
+	return strings.Trim(b.String(), "-")
+}
+
+// attachmentSlug returns the base name used for a note's renamed attachments.
+// When another note already uses the same slug, a short hash of the note's
+// file path is appended so object keys never collide.
+func (c *Converter) attachmentSlug(note *KeepNote, filePath string) string {
+	slug := slugify(note.Title)
+	if slug == "" {
+		slug = slugify(shortenFilename(filePath, DefaultFilenameTitleLength))
+	}
+	if slug == "" {
+		slug = "note"
+	}
+
+	c.slugsMu.Lock()
+	defer c.slugsMu.Unlock()
+
+	if owner, ok := c.slugOwners[slug]; ok && owner != filePath {
+		sum := sha256.Sum256([]byte(filePath))
+		slug += "-" + hex.EncodeToString(sum[:])[:6]
+	}
+	c.slugOwners[slug] = filePath
+	return slug
+}
+
+var (
+	// htmlHeadingPattern matches the first heading in note HTML
+	htmlHeadingPattern = regexp.MustCompile(`(?is)<h[1-3][^>]*>(.*?)</h[1-3]>`)
+	// htmlLeadingBoldPattern matches bold text at the very start of note HTML,
+	// allowing for wrapping paragraph and span elements
+	htmlLeadingBoldPattern = regexp.MustCompile(`(?is)^\s*(?:<(?:p|span|div)[^>]*>\s*)*<(?:b|strong)[^>]*>(.*?)</(?:b|strong)>`)
+	// htmlTagPattern matches any HTML tag
+	htmlTagPattern = regexp.MustCompile(`<[^>]*>`)
+	// htmlLinkPattern matches a link and captures its target and text
+	htmlLinkPattern = regexp.MustCompile(`(?is)<a\s[^>]*href\s*=\s*["']([^"']*)["'][^>]*>(.*?)</a>`)
+	// htmlBreakPattern matches line breaks and the ends of block elements
+	htmlBreakPattern = regexp.MustCompile(`(?i)<br\s*/?>|</(?:p|div|h[1-6]|ul|ol)>`)
+	// htmlListItemPattern matches the start of a list item
+	htmlListItemPattern = regexp.MustCompile(`(?i)<li[^>]*>`)
+	// blankLinesPattern matches runs of more than one empty line
+	blankLinesPattern = regexp.MustCompile(`\n{3,}`)
+)
+
+// htmlToText converts note HTML to plain text, keeping line breaks, list items
+// as "- " bullets and links in Markdown form
+func htmlToText(noteHTML string) string {
+	text := htmlLinkPattern.ReplaceAllStringFunc(noteHTML, func(link string) string {
+		match := htmlLinkPattern.FindStringSubmatch(link)
+		label := strings.TrimSpace(htmlTagPattern.ReplaceAllString(match[2], ""))
+		if label == "" || label == match[1] {
+			return match[1]
+		}
+		return "[" + label + "](" + match[1] + ")"
+	})
+	text = strings.NewReplacer("\r", "", "\n", " ").Replace(text) // Source line breaks are just spaces in HTML
+	text = htmlListItemPattern.ReplaceAllString(text, "\n- ")
+	text = htmlBreakPattern.ReplaceAllString(text, "\n")
+	text = html.UnescapeString(htmlTagPattern.ReplaceAllString(text, ""))
+
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSpace(line)
+	}
+	text = blankLinesPattern.ReplaceAllString(strings.Join(lines, "\n"), "\n\n")
+	return strings.TrimSpace(text)
+}
+
+// htmlTitle extracts a title from the first heading, or leading bold text, of note HTML
+func htmlTitle(noteHTML string) string {
+	match := htmlHeadingPattern.FindStringSubmatch(noteHTML)
+	if match == nil {
+		match = htmlLeadingBoldPattern.FindStringSubmatch(noteHTML)
+	}
+	if match == nil {
+		return ""
+	}
+
+	title := html.UnescapeString(htmlTagPattern.ReplaceAllString(match[1], ""))
+	return strings.Join(strings.Fields(title), " ")
+}
@@ -0,0 +1,468 @@
+package converter
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+)
+
+// newQuietConverter returns a converter with the given options that draws no
+// progress bar
+func newQuietConverter(t *testing.T, opts Options) *Converter {
+	t.Helper()
+	opts.ProgressOutput = io.Discard
+	c, err := New(opts)
+	if err != nil {
+		t.Fatalf("New() error = %v", err)
+	}
+	return c
+}
+
+func TestParseKeepNote(t *testing.T) {
+	tests := []struct {
+		file string
+		want KeepNote
+	}{
+		{
+			file: "Packing list.json",
+			want: KeepNote{
+				Title:    "Packing list",
+				Color:    "BLUE",
+				IsPinned: true,
+				ListContent: []ListItem{
+					{Text: "Passport", IsChecked: true},
+					{Text: "Phone charger"},
+					{Text: "Swimsuit"},
+				},
+				Labels:                  []Label{{Name: "Travel"}, {Name: "to/do"}},
+				CreatedTimestampUsec:    1711392000000000,
+				UserEditedTimestampUsec: 1711478400000000,
+			},
+		},
+		{
+			file: "Café ☕ Málaga.json",
+			want: KeepNote{
+				Title:                   "Café ☕ Málaga",
+				TextContent:             "Café con leche y churros 🍩\nPedir «mitad» en vez de «sombra»\n日本語のメモ",
+				TextContentHTML:         `<p dir="ltr"><span>Café con leche y churros 🍩</span></p><p dir="ltr"><span>Pedir «mitad» en vez de «sombra»</span></p><p dir="ltr"><span>日本語のメモ</span></p>`,
+				Color:                   "YELLOW",
+				Labels:                  []Label{{Name: "Comida española"}, {Name: "2024 goals"}},
+				CreatedTimestampUsec:    1711564800000000,
+				UserEditedTimestampUsec: 1711564800000000,
+			},
+		},
+		{
+			file: "reminders/Dentist.json",
+			want: KeepNote{
+				Title:       "Dentist",
+				TextContent: "Bring the insurance card",
+				Color:       "DEFAULT",
+				Reminders: []Reminder{
+					{TimestampUsec: 4078713600000000},
+					{TimestampUsec: 1704888000000000},
+					{TimestampUsec: 4078114200000000},
+				},
+				CreatedTimestampUsec:    1704888000000000,
+				UserEditedTimestampUsec: 1704888000000000,
+			},
+		},
+		{
+			file: "Shopping (HTML only).json",
+			want: KeepNote{
+				TextContent:             "Things to get before the trip:\n\n- Sunscreen & hat\n- Adapter for UK plugs\nGuide: [Spain travel info](https://www.spain.info/en/)\nAsk Ana about the hotel",
+				TextContentHTML:         `<p dir="ltr" style="line-height:1.38;margin-top:0.0pt;margin-bottom:0.0pt;"><span>Things to get before the trip:</span></p><ul><li>Sunscreen &amp; hat</li><li>Adapter for <b>UK</b> plugs</li></ul><p>Guide: <a href="https://www.spain.info/en/">Spain travel info</a><br>Ask Ana about the hotel</p>`,
+				Color:                   "DEFAULT",
+				CreatedTimestampUsec:    1711391361446000,
+				UserEditedTimestampUsec: 1711391361446000,
+			},
+		},
+		{
+			file: "Whiteboard.json",
+			want: KeepNote{
+				Title:       "Whiteboard",
+				TextContent: "Sprint planning notes",
+				Color:       "GREEN",
+				Attachments: []Attachment{
+					{FilePath: "1a2b3c4d5e6.f7a8b9c0d1e2f3a4.jpg", MimeType: "image/jpeg"},
+					{FilePath: "2b3c4d5e6f7.a8b9c0d1e2f3a4b5.pdf", MimeType: "application/pdf"},
+				},
+				CreatedTimestampUsec:    1711990000000000,
+				UserEditedTimestampUsec: 1712000000000000,
+			},
+		},
+		{
+			file: "Old address.json",
+			want: KeepNote{
+				Title:                   "Old address",
+				TextContent:             "Calle Larios 5, 29005 Málaga",
+				Color:                   "DEFAULT",
+				IsArchived:              true,
+				CreatedTimestampUsec:    1577836800000000,
+				UserEditedTimestampUsec: 1609459200000000,
+			},
+		},
+		{
+			file: "Call the plumber.json",
+			want: KeepNote{
+				Title:                   "Call the plumber",
+				TextContent:             "Leaking tap in the kitchen\nAvailable after 5pm",
+				Color:                   "DEFAULT",
+				CreatedTimestampUsec:    1711650000000000,
+				UserEditedTimestampUsec: 1711650000000000,
+			},
+		},
+	}
+
+	c := newQuietConverter(t, Options{})
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			note, err := c.parseKeepNote(filepath.Join("testdata", tt.file), DefaultMaxFileSize)
+			if err != nil {
+				t.Fatalf("parseKeepNote() error = %v", err)
+			}
+			if !reflect.DeepEqual(*note, tt.want) {
+				t.Errorf("parseKeepNote() =\n%+v\nwant\n%+v", *note, tt.want)
+			}
+		})
+	}
+}
+
+func TestFormatTag(t *testing.T) {
+	tests := []struct {
+		name      string
+		separator string
+		tagCase   string
+		want      string
+	}{
+		{"C#", TagSeparatorUnderscore, TagCasePreserve, "C"},
+		{"to/do", TagSeparatorUnderscore, TagCasePreserve, "to_do"},
+		{"2024 goals", TagSeparatorUnderscore, TagCasePreserve, "_2024_goals"},
+		{"My  Project", TagSeparatorUnderscore, TagCasePreserve, "My_Project"},
+		{"My Project", TagSeparatorDash, TagCaseLower, "my-project"},
+		{"my project", TagSeparatorCamel, TagCasePreserve, "MyProject"},
+		{"My project", TagSeparatorRemove, TagCaseUpper, "MYPROJECT"},
+		{"Comida española", TagSeparatorUnderscore, TagCasePreserve, "Comida_española"},
+		{"#/!", TagSeparatorUnderscore, TagCasePreserve, ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name+"/"+tt.separator+"/"+tt.tagCase, func(t *testing.T) {
+			if got := formatTag(tt.name, tt.separator, tt.tagCase); got != tt.want {
+				t.Errorf("formatTag(%q) = %q, want %q", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestColorTag(t *testing.T) {
+	tests := []struct {
+		color  string
+		prefix string
+		want   string
+	}{
+		{"", "color_", ""},
+		{"DEFAULT", "color_", ""},
+		{"default", "", ""},
+		{"BLUE", "color_", "#color_blue"},
+		{"Yellow", "keep_", "#keep_yellow"},
+		{"GREEN", "", "#green"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.color+"/"+tt.prefix, func(t *testing.T) {
+			if got := colorTag(tt.color, tt.prefix); got != tt.want {
+				t.Errorf("colorTag(%q, %q) = %q, want %q", tt.color, tt.prefix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestContentHash(t *testing.T) {
+	note := KeepNote{Title: "Packing list", TextContent: "Passport", ListContent: []ListItem{{Text: "Swimsuit"}}}
+	hash := contentHash(&note)
+	if len(hash) != 8 {
+		t.Errorf("contentHash() = %q, want 8 hex digits", hash)
+	}
+
+	// The hash must not depend on anything but the content, e.g. for the next run
+	same := note
+	same.IsPinned = true
+	same.UserEditedTimestampUsec = 1711478400000000
+	if got := contentHash(&same); got != hash {
+		t.Errorf("contentHash() of the same content = %q, want %q", got, hash)
+	}
+
+	for name, changed := range map[string]KeepNote{
+		"title": {Title: "Packing list 2", TextContent: note.TextContent, ListContent: note.ListContent},
+		"text":  {Title: note.Title, TextContent: "Passport and visa", ListContent: note.ListContent},
+		"list":  {Title: note.Title, TextContent: note.TextContent, ListContent: []ListItem{{Text: "Sunscreen"}}},
+	} {
+		if got := contentHash(&changed); got == hash {
+			t.Errorf("contentHash() with changed %s = %q, want it to differ", name, got)
+		}
+	}
+}
+
+func TestPreferHTMLTitle(t *testing.T) {
+	tests := []struct {
+		file            string
+		preferHTMLTitle bool
+		want            string
+	}{
+		{"Gazpacho (HTML title).json", false, "Gazpacho for six: tomatoes, cucumber and peppers"},
+		{"Gazpacho (HTML title).json", true, "Gazpacho"},
+		{"Café ☕ Málaga.json", true, "Café ☕ Málaga"}, // Own titles always win
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s/%v", tt.file, tt.preferHTMLTitle), func(t *testing.T) {
+			c := newQuietConverter(t, Options{PreferHTMLTitle: tt.preferHTMLTitle})
+			filePath := filepath.Join("testdata", tt.file)
+			note, err := c.parseKeepNote(filePath, DefaultMaxFileSize)
+			if err != nil {
+				t.Fatalf("parseKeepNote() error = %v", err)
+			}
+			if got := c.buildBaseTitle(note, filePath); got != tt.want {
+				t.Errorf("buildBaseTitle() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFolderTags(t *testing.T) {
+	folder := filepath.Join("Takeout", "Keep")
+	tests := []struct {
+		file      string
+		namespace string
+		want      string
+	}{
+		{filepath.Join(folder, "note.json"), "", ""},
+		{filepath.Join(folder, "Projects", "note.json"), "", "#projects"},
+		{filepath.Join(folder, "Projects", "Alpha Launch", "note.json"), "", "#projects #alpha_launch"},
+		{filepath.Join(folder, "Projects", "Alpha Launch", "note.json"), "keep_", "#keep_projects #keep_alpha_launch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.file+"/"+tt.namespace, func(t *testing.T) {
+			if got := folderTags(folder, tt.file, tt.namespace); got != tt.want {
+				t.Errorf("folderTags(%q, %q, %q) = %q, want %q", folder, tt.file, tt.namespace, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShortenFilename(t *testing.T) {
+	tests := []struct {
+		filename string
+		maxLen   int
+		want     string
+	}{
+		{"Takeout/Keep/Groceries.json", 15, "Groceries"},
+		{"A rather long file name.json", 15, "A rather long f..."},
+		{"🎉🎂🎈 Party planning.json", 5, "🎉🎂🎈 P..."},
+		{"Café ☕ Málaga.json", 6, "Café ☕..."},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got := shortenFilename(tt.filename, tt.maxLen)
+			if got != tt.want {
+				t.Errorf("shortenFilename(%q, %d) = %q, want %q", tt.filename, tt.maxLen, got, tt.want)
+			}
+			if !utf8.ValidString(got) {
+				t.Errorf("shortenFilename(%q, %d) = %q is not valid UTF-8", tt.filename, tt.maxLen, got)
+			}
+		})
+	}
+}
+
+func TestParseKeepNoteInvalidFiles(t *testing.T) {
+	tests := []struct {
+		file       string
+		notKeepErr bool // Whether the file is reported as not a Keep note rather than corrupt
+	}{
+		{"empty.json", true},
+		{"index.json", true},
+		{"truncated.json", false},
+	}
+
+	c := newQuietConverter(t, Options{})
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			_, err := c.parseKeepNote(filepath.Join("testdata", tt.file), DefaultMaxFileSize)
+			if err == nil {
+				t.Fatal("parseKeepNote() error = nil, want an error")
+			}
+			if got := errors.Is(err, ErrNotKeepNote); got != tt.notKeepErr {
+				t.Errorf("parseKeepNote() error = %v, errors.Is(err, ErrNotKeepNote) = %v, want %v", err, got, tt.notKeepErr)
+			}
+		})
+	}
+}
+
+func TestParseKeepNoteMaxSize(t *testing.T) {
+	const fixture = "testdata/oversized.json" // About 4 KB
+	c := newQuietConverter(t, Options{})
+
+	if _, err := c.parseKeepNote(fixture, 1024); err == nil {
+		t.Error("parseKeepNote() with a 1 KB limit error = nil, want the file rejected")
+	} else if errors.Is(err, ErrNotKeepNote) {
+		t.Errorf("parseKeepNote() error = %v, want a size error, not ErrNotKeepNote", err)
+	}
+
+	for _, maxSize := range []int64{0, DefaultMaxFileSize} {
+		note, err := c.parseKeepNote(fixture, maxSize)
+		if err != nil {
+			t.Fatalf("parseKeepNote() with limit %d error = %v", maxSize, err)
+		}
+		if note.Title != "Pasted image" {
+			t.Errorf("parseKeepNote() with limit %d title = %q, want %q", maxSize, note.Title, "Pasted image")
+		}
+	}
+}
+
+func TestStreamNoteArray(t *testing.T) {
+	const fixture = "testdata/array/Keep export.json"
+	c := newQuietConverter(t, Options{})
+
+	if _, err := c.parseKeepNote(fixture, DefaultMaxFileSize); !errors.Is(err, errNoteArray) {
+		t.Errorf("parseKeepNote() error = %v, want errNoteArray", err)
+	}
+
+	var titles []string
+	isArray, err := c.streamNoteArray(fixture, func(element int, note *KeepNote, err error) bool {
+		if err != nil {
+			t.Fatalf("element %d error = %v", element, err)
+		}
+		if element != len(titles)+1 {
+			t.Errorf("element = %d, want %d", element, len(titles)+1)
+		}
+		titles = append(titles, note.Title)
+		return true
+	})
+	if !isArray || err != nil {
+		t.Fatalf("streamNoteArray() = %v, %v, want true, nil", isArray, err)
+	}
+	if want := []string{"Chores", "Groceries", ""}; !reflect.DeepEqual(titles, want) {
+		t.Errorf("streamNoteArray() titles = %q, want %q", titles, want)
+	}
+	if got := c.countNoteArray(fixture); got != 3 {
+		t.Errorf("countNoteArray() = %d, want 3", got)
+	}
+
+	// Files with a single note are left to parseKeepNote
+	isArray, err = c.streamNoteArray("testdata/Packing list.json", func(int, *KeepNote, error) bool {
+		t.Error("streamNoteArray() called fn for a single-note file")
+		return true
+	})
+	if isArray || err != nil {
+		t.Errorf("streamNoteArray() on a single-note file = %v, %v, want false, nil", isArray, err)
+	}
+}
+
+func TestStreamNoteArrayLargeFile(t *testing.T) {
+	const notes = 20000
+	path := filepath.Join(t.TempDir(), "export.json")
+	file, err := os.Create(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	writer := bufio.NewWriter(file)
+	text := strings.Repeat("Lorem ipsum dolor sit amet. ", 40) // About 1 KB per note
+	writer.WriteString("[")
+	for i := range notes {
+		if i > 0 {
+			writer.WriteString(",\n")
+		}
+		fmt.Fprintf(writer, `{"title":"Note %d","textContent":%q,"createdTimestampUsec":1711391361446000}`, i, text)
+	}
+	writer.WriteString("]")
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	file.Close()
+
+	// The file is about 20 MB, so the heap must not grow anywhere near that
+	// while the notes are decoded one at a time
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	baseline, peak := stats.HeapAlloc, stats.HeapAlloc
+
+	c := newQuietConverter(t, Options{})
+	count := 0
+	_, err = c.streamNoteArray(path, func(element int, note *KeepNote, err error) bool {
+		if err != nil {
+			t.Fatalf("element %d error = %v", element, err)
+		}
+		count++
+		if count%2000 == 0 {
+			runtime.GC()
+			runtime.ReadMemStats(&stats)
+			peak = max(peak, stats.HeapAlloc)
+		}
+		return true
+	})
+	if err != nil {
+		t.Fatalf("streamNoteArray() error = %v", err)
+	}
+	if count != notes {
+		t.Errorf("streamNoteArray() decoded %d notes, want %d", count, notes)
+	}
+	if growth := int64(peak) - int64(baseline); growth > 4<<20 {
+		t.Errorf("heap grew by %d bytes while streaming, want less than 4 MB", growth)
+	}
+}
+
+func TestUsecToTime(t *testing.T) {
+	tokyo := time.FixedZone("JST", 9*60*60)
+	newYork := time.FixedZone("EST", -5*60*60)
+
+	tests := []struct {
+		name string
+		usec int64
+		loc  *time.Location
+		want string
+	}{
+		{"epoch in UTC", 0, time.UTC, "1970-01-01T00:00:00Z"},
+		{"epoch east of UTC", 0, tokyo, "1970-01-01T09:00:00+09:00"},
+		{"epoch west of UTC is the day before", 0, newYork, "1969-12-31T19:00:00-05:00"},
+		{"one microsecond before the epoch", -1, time.UTC, "1969-12-31T23:59:59.999999Z"},
+		{"microseconds are kept", 1711391361446123, time.UTC, "2024-03-25T18:29:21.446123Z"},
+		{"date changes with the zone", 1711391361446000, tokyo, "2024-03-26T03:29:21.446+09:00"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := usecToTime(tt.usec, tt.loc).Format(time.RFC3339Nano); got != tt.want {
+				t.Errorf("usecToTime(%d) = %s, want %s", tt.usec, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTimestampFooter(t *testing.T) {
+	tests := []struct {
+		name string
+		note KeepNote
+		want string
+	}{
+		{"zero timestamps", KeepNote{}, ""},
+		{"only created", KeepNote{CreatedTimestampUsec: 1711391361446000}, "Created: 2024-03-25T18:29:21Z"},
+		{
+			name: "created and edited",
+			note: KeepNote{CreatedTimestampUsec: 1711391361446000, UserEditedTimestampUsec: 1711478400000000},
+			want: "Created: 2024-03-25T18:29:21Z\nEdited: 2024-03-26T18:40:00Z",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := timestampFooter(&tt.note, time.RFC3339, time.UTC); got != tt.want {
+				t.Errorf("timestampFooter() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LabelColor colors the Dynalist nodes of notes with a label
+type LabelColor struct {
+	Label string // Label name, matched like Labels ignoring case and surrounding spaces
+	Color string // One of red, orange, yellow, green, blue or purple
+}
+
+// dynalistColors maps color names to the color numbers of the Dynalist API
+var dynalistColors = map[string]int{
+	"red":    1,
+	"orange": 2,
+	"yellow": 3,
+	"green":  4,
+	"blue":   5,
+	"purple": 6,
+}
+
+// validateLabelColors checks that every label color names a Dynalist color
+func validateLabelColors(colors []LabelColor) error {
+	for _, lc := range colors {
+		if _, ok := dynalistColors[strings.ToLower(lc.Color)]; !ok {
+			return fmt.Errorf("invalid color %q for label %q, expected red, orange, yellow, green, blue or purple", lc.Color, lc.Label)
+		}
+	}
+	return nil
+}
+
+// labelColor returns the Dynalist color number of a note, from the first label
+// color whose label the note has, or 0 for no color
+func (c *Converter) labelColor(note *KeepNote) int {
+	for _, lc := range c.opts.LabelColors {
+		if hasAnyLabel(note, []string{lc.Label}) {
+			return dynalistColors[strings.ToLower(lc.Color)]
+		}
+	}
+	return 0
+}
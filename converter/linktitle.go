@@ -0,0 +1,76 @@
+package converter
+
+import (
+	"context"
+	"html"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	urlTitleTimeout  = 10 * time.Second // Maximum time spent fetching a page title
+	urlTitleMaxBytes = 512 * 1024       // Only the start of a page is searched for its title
+)
+
+// htmlTitleTagPattern matches the <title> element of a web page
+var htmlTitleTagPattern = regexp.MustCompile(`(?is)<title[^>]*>(.*?)</title>`)
+
+// singleURL returns the note text if it consists of nothing but one http(s) URL
+func singleURL(text string) string {
+	text = strings.TrimSpace(text)
+	if text == "" || strings.ContainsAny(text, " \t\r\n") {
+		return ""
+	}
+
+	parsed, err := url.Parse(text)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ""
+	}
+	return text
+}
+
+// fetchURLTitle fetches a web page and returns its <title>, falling back to the
+// URL itself. The fetch is abandoned when the context is cancelled.
+func fetchURLTitle(ctx context.Context, pageURL string) string {
+	ctx, cancel := context.WithTimeout(ctx, urlTitleTimeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, "GET", pageURL, nil)
+	if err != nil {
+		log.Printf("Failed to fetch title of %s: %v", pageURL, err)
+		return pageURL
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		log.Printf("Failed to fetch title of %s: %v", pageURL, err)
+		return pageURL
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		log.Printf("Failed to fetch title of %s: status code %d", pageURL, resp.StatusCode)
+		return pageURL
+	}
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, urlTitleMaxBytes))
+	if err != nil {
+		log.Printf("Failed to read %s: %v", pageURL, err)
+		return pageURL
+	}
+
+	match := htmlTitleTagPattern.FindSubmatch(body)
+	if match == nil {
+		return pageURL
+	}
+
+	title := strings.Join(strings.Fields(html.UnescapeString(string(match[1]))), " ")
+	if title == "" {
+		return pageURL
+	}
+	return title
+}
@@ -0,0 +1,75 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// localUploader "uploads" attachments by copying them into a local directory
+// and links them with file:// URLs, for users without cloud storage
+type localUploader struct {
+	dir        string
+	publicBase string // Links files under this URL instead of file:// when set, e.g. a web server for dir
+}
+
+// newLocalUploader creates the media directory if needed and returns an uploader for it
+func newLocalUploader(dir string) (*localUploader, error) {
+	if dir == "" {
+		return nil, fmt.Errorf("missing media directory, set -media-dir or MEDIA_DIR")
+	}
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve media directory: %w", err)
+	}
+	if err := os.MkdirAll(absDir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create media directory: %w", err)
+	}
+	return &localUploader{dir: absDir}, nil
+}
+
+// ObjectURL returns the file:// URL a file with the given name gets in the media
+// directory, or its public URL when a public base URL is set
+func (u *localUploader) ObjectURL(objectKey string) string {
+	if u.publicBase != "" {
+		return publicObjectURL(u.publicBase, objectKey)
+	}
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(u.dir, objectKey))}).String()
+}
+
+// UploadFile writes in-memory data into the media directory and returns its URL
+func (u *localUploader) UploadFile(ctx context.Context, fileData []byte, fileExt string) (string, error) {
+	fileName := fmt.Sprintf("%d%s", time.Now().UnixNano(), fileExt)
+	return u.writeFile(ctx, fileData, fileName)
+}
+
+// UploadLocalFile copies a local file into the media directory under a generated
+// name and returns its URL. Local files carry no object metadata.
+func (u *localUploader) UploadLocalFile(ctx context.Context, filePath string, metadata map[string]string) (string, error) {
+	fileName := fmt.Sprintf("%d%s", time.Now().UnixNano(), filepath.Ext(filePath))
+	return u.UploadLocalFileAs(ctx, filePath, fileName, metadata)
+}
+
+// UploadLocalFileAs copies a local file into the media directory under the given name
+func (u *localUploader) UploadLocalFileAs(ctx context.Context, filePath string, objectKey string, metadata map[string]string) (string, error) {
+	fileData, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+	return u.writeFile(ctx, fileData, objectKey)
+}
+
+// writeFile stores data in the media directory and returns its URL, unless
+// the context is already cancelled
+func (u *localUploader) writeFile(ctx context.Context, fileData []byte, fileName string) (string, error) {
+	if err := ctx.Err(); err != nil {
+		return "", err
+	}
+	if err := os.WriteFile(filepath.Join(u.dir, fileName), fileData, 0644); err != nil {
+		return "", fmt.Errorf("failed to write media file: %w", err)
+	}
+	return u.ObjectURL(fileName), nil
+}
@@ -0,0 +1,78 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// maxMarkdownNameLength caps the length (in runes) of generated Markdown file names
+const maxMarkdownNameLength = 100
+
+// writeMarkdownNote writes a note as a Markdown file into dir and returns the file path.
+// The file is named name; a counter is appended when the name is taken.
+func writeMarkdownNote(dir string, name string, title string, content string, items []ListItem) (string, error) {
+	var b strings.Builder
+	b.WriteString("# " + title + "\n\n")
+	for _, item := range items {
+		checkbox := "[ ]"
+		if item.IsChecked {
+			checkbox = "[x]"
+		}
+		b.WriteString("- " + checkbox + " " + item.Text + "\n")
+	}
+	if len(items) > 0 {
+		b.WriteString("\n")
+	}
+	if content != "" {
+		b.WriteString(content + "\n")
+	}
+
+	baseName := markdownFileName(name)
+	for counter := 1; ; counter++ {
+		name := baseName + ".md"
+		if counter > 1 {
+			name = fmt.Sprintf("%s-%d.md", baseName, counter)
+		}
+		path := filepath.Join(dir, name)
+
+		// Create exclusively so concurrent workers never overwrite each other
+		file, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+		if errors.Is(err, os.ErrExist) {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to create Markdown file: %w", err)
+		}
+
+		_, err = file.WriteString(b.String())
+		if closeErr := file.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to write Markdown file: %w", err)
+		}
+		return path, nil
+	}
+}
+
+// markdownFileName turns a note title into a safe file name without extension
+func markdownFileName(title string) string {
+	name := strings.Map(func(r rune) rune {
+		if r < 32 || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, title)
+	name = strings.Trim(strings.TrimSpace(name), ".")
+
+	if runes := []rune(name); len(runes) > maxMarkdownNameLength {
+		name = strings.TrimSpace(string(runes[:maxMarkdownNameLength]))
+	}
+	if name == "" {
+		name = "untitled"
+	}
+	return name
+}
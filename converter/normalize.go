@@ -0,0 +1,47 @@
+package converter
+
+import (
+	"fmt"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+// Supported Unicode normalization forms for the text sent to Dynalist
+const (
+	NormalizeNFC  = "nfc"  // Compose characters, e.g. "e" + combining accent becomes "é"
+	NormalizeNFKC = "nfkc" // Also replace compatibility characters, e.g. full-width "！" becomes "!"
+)
+
+// validateNormalization checks that the Unicode normalization form is supported
+func validateNormalization(form string) error {
+	switch form {
+	case "", NormalizeNFC, NormalizeNFKC:
+		return nil
+	default:
+		return fmt.Errorf("invalid Unicode normalization %q (use nfc or nfkc)", form)
+	}
+}
+
+// normalize applies the requested Unicode normalization to text, if any
+func (c *Converter) normalize(text string) string {
+	switch c.opts.NormalizeUnicode {
+	case NormalizeNFC:
+		return norm.NFC.String(text)
+	case NormalizeNFKC:
+		return norm.NFKC.String(text)
+	default:
+		return text
+	}
+}
+
+// normalizeItems returns the checklist items with their text normalized
+func (c *Converter) normalizeItems(items []ListItem) []ListItem {
+	if c.opts.NormalizeUnicode == "" {
+		return items
+	}
+	normalized := make([]ListItem, len(items))
+	for i, item := range items {
+		normalized[i] = ListItem{Text: c.normalize(item.Text), IsChecked: item.IsChecked}
+	}
+	return normalized
+}
@@ -0,0 +1,65 @@
+package converter
+
+import "testing"
+
+func TestNormalize(t *testing.T) {
+	const (
+		decomposed = "Cafe\u0301"                                  // "e" followed by a combining acute accent
+		composed   = "Caf\u00e9"                                   // Precomposed "é"
+		fullWidth  = "\uff28\uff45\uff4c\uff4c\uff4f\uff01 \u2460" // Full-width "Hello!" and a circled digit one
+		ligature   = "\ufb01le"                                    // "fi" ligature followed by "le"
+		hangul     = "\u1112\u1161\u11ab"                          // Hangul syllable "han" as conjoining jamo
+	)
+
+	tests := []struct {
+		name  string
+		form  string
+		input string
+		want  string
+	}{
+		{"none keeps decomposed", "", decomposed, decomposed},
+		{"nfc composes", NormalizeNFC, decomposed, composed},
+		{"nfc keeps composed", NormalizeNFC, composed, composed},
+		{"nfc keeps full-width", NormalizeNFC, fullWidth, fullWidth},
+		{"nfc keeps ligatures", NormalizeNFC, ligature, ligature},
+		{"nfc composes hangul", NormalizeNFC, hangul, "\ud55c"},
+		{"nfkc composes", NormalizeNFKC, decomposed, composed},
+		{"nfkc folds full-width", NormalizeNFKC, fullWidth, "Hello! 1"},
+		{"nfkc splits ligatures", NormalizeNFKC, ligature, "file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newQuietConverter(t, Options{NormalizeUnicode: tt.form})
+			if got := c.normalize(tt.input); got != tt.want {
+				t.Errorf("normalize(%q) = %q, want %q", tt.input, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeItems(t *testing.T) {
+	c := newQuietConverter(t, Options{NormalizeUnicode: NormalizeNFC})
+	items := []ListItem{{Text: "Cafe\u0301", IsChecked: true}, {Text: "Tea"}}
+
+	got := c.normalizeItems(items)
+	want := []ListItem{{Text: "Caf\u00e9", IsChecked: true}, {Text: "Tea"}}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("normalizeItems()[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if items[0].Text != "Cafe\u0301" {
+		t.Errorf("normalizeItems() changed its input to %q", items[0].Text)
+	}
+}
+
+func TestValidateNormalization(t *testing.T) {
+	for _, form := range []string{"", NormalizeNFC, NormalizeNFKC} {
+		if err := validateNormalization(form); err != nil {
+			t.Errorf("validateNormalization(%q) error = %v", form, err)
+		}
+	}
+	if err := validateNormalization("nfd"); err == nil {
+		t.Error(`validateNormalization("nfd") error = nil, want an error`)
+	}
+}
@@ -0,0 +1,70 @@
+package converter
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// previousExport indexes the notes of an earlier takeout export so that only
+// new or changed notes are migrated from the current one
+type previousExport struct {
+	hashes map[string]bool // Content hashes of all previously exported notes
+	paths  map[string]bool // Note paths relative to the previous export folder
+}
+
+// LoadPreviousExport parses every note in a previous takeout folder, so that
+// only notes new or changed relative to it are migrated. A zip takeout must be
+// opened with OpenTakeout first.
+func (c *Converter) LoadPreviousExport(folderPath string) error {
+	previous := &previousExport{
+		hashes: make(map[string]bool),
+		paths:  make(map[string]bool),
+	}
+
+	err := c.walkTakeout(folderPath, func(filePath string, isDir bool) error {
+		if isDir || filepath.Ext(filePath) != ".json" {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(folderPath, filePath)
+		if err != nil {
+			return err
+		}
+
+		// Files holding an array of notes are read note by note
+		isArray, _ := c.streamNoteArray(filePath, func(element int, note *KeepNote, err error) bool {
+			if err == nil {
+				previous.paths[noteFile{path: relPath, element: element}.id()] = true
+				previous.hashes[contentHash(note)] = true
+			}
+			return true
+		})
+		if isArray {
+			return nil
+		}
+
+		note, err := c.parseKeepNote(filePath, c.opts.MaxFileSize)
+		if err != nil {
+			return nil // Unparseable notes can't be compared against
+		}
+		previous.paths[relPath] = true
+		previous.hashes[contentHash(note)] = true
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("failed to read previous export: %w", err)
+	}
+
+	c.previous = previous
+	return nil
+}
+
+// isUnchanged reports whether the same note content was already in the previous export
+func (p *previousExport) isUnchanged(note *KeepNote) bool {
+	return p.hashes[contentHash(note)]
+}
+
+// isKnown reports whether a note at this relative path existed in the previous export
+func (p *previousExport) isKnown(relPath string) bool {
+	return p.paths[relPath]
+}
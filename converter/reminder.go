@@ -0,0 +1,28 @@
+package converter
+
+import (
+	"time"
+)
+
+// Reminder is a time Keep reminds the user of a note
+type Reminder struct {
+	TimestampUsec int64 `json:"timestampUsec"`
+}
+
+// nextReminder returns the earliest reminder of a note after now, or the zero
+// time when it has none
+func nextReminder(note *KeepNote, now time.Time) time.Time {
+	var next time.Time
+	for _, reminder := range note.Reminders {
+		at := time.UnixMicro(reminder.TimestampUsec)
+		if at.After(now) && (next.IsZero() || at.Before(next)) {
+			next = at
+		}
+	}
+	return next
+}
+
+// dueMarker formats a due date in Dynalist's date syntax, e.g. "!(2024-03-25 10:00)"
+func dueMarker(due time.Time, loc *time.Location) string {
+	return "!(" + due.In(loc).Format("2006-01-02 15:04") + ")"
+}
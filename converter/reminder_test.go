@@ -0,0 +1,59 @@
+package converter
+
+import (
+	"context"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestProcessFolderRemindersAsTasks(t *testing.T) {
+	server := newDocumentServer(t)
+	c := newQuietConverter(t, Options{
+		Token:            "test-token",
+		APIBaseURL:       server.URL,
+		Retry:            testRetryConfig,
+		DocID:            "doc",
+		RemindersAsTasks: true,
+		Location:         time.UTC,
+		Quiet:            true,
+	})
+	if err := c.ProcessFolder(context.Background(), filepath.Join("testdata", "reminders")); err != nil {
+		t.Fatalf("ProcessFolder() error = %v", err)
+	}
+
+	nodes := make(map[string]dynalistChange)
+	for _, change := range server.changes {
+		title, _, _ := strings.Cut(change.Content, " ")
+		nodes[title] = change
+	}
+	if len(nodes) != 2 {
+		t.Fatalf("server received %d nodes, want 2: %+v", len(server.changes), server.changes)
+	}
+
+	// The earliest future reminder is the due date, past ones are ignored
+	dentist := nodes["Dentist"]
+	if !dentist.Checkbox || dentist.Checked || !strings.HasSuffix(dentist.Content, " !(2099-03-25 09:30)") {
+		t.Errorf("Dentist node = %+v, want an unchecked checkbox due 2099-03-25 09:30", dentist)
+	}
+	renew := nodes["Renew"]
+	if renew.Checkbox || strings.Contains(renew.Content, "!(") {
+		t.Errorf("Renew passport node = %+v, want a plain item without due date", renew)
+	}
+}
+
+func TestNextReminder(t *testing.T) {
+	now := time.Date(2024, 3, 25, 12, 0, 0, 0, time.UTC)
+	note := &KeepNote{Reminders: []Reminder{
+		{TimestampUsec: now.Add(-time.Hour).UnixMicro()},
+		{TimestampUsec: now.Add(48 * time.Hour).UnixMicro()},
+		{TimestampUsec: now.Add(24 * time.Hour).UnixMicro()},
+	}}
+	if got, want := nextReminder(note, now), now.Add(24*time.Hour); !got.Equal(want) {
+		t.Errorf("nextReminder() = %v, want %v", got, want)
+	}
+	if got := nextReminder(&KeepNote{}, now); !got.IsZero() {
+		t.Errorf("nextReminder() without reminders = %v, want the zero time", got)
+	}
+}
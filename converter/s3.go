@@ -0,0 +1,86 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// awsS3Client represents a client for AWS S3 storage
+type awsS3Client struct {
+	s3Client   *s3.Client
+	bucketName string
+	region     string
+	publicBase string // Links objects under this URL instead of the bucket endpoint when set
+}
+
+// newS3Client creates a new AWS S3 client. Credentials are resolved through
+// the standard AWS chain (environment, shared config, instance roles).
+func newS3Client() (*awsS3Client, error) {
+	bucketName := os.Getenv("S3_BUCKET_NAME")
+	if bucketName == "" {
+		return nil, fmt.Errorf("missing required S3_BUCKET_NAME environment variable")
+	}
+
+	cfg, err := config.LoadDefaultConfig(context.TODO())
+	if err != nil {
+		return nil, fmt.Errorf("failed to load AWS config: %w", err)
+	}
+	if cfg.Region == "" {
+		return nil, fmt.Errorf("missing AWS region, set AWS_REGION")
+	}
+
+	return &awsS3Client{
+		s3Client:   s3.NewFromConfig(cfg),
+		bucketName: bucketName,
+		region:     cfg.Region,
+	}, nil
+}
+
+// ObjectURL returns the virtual-hosted-style URL of an object, or its public
+// URL when a public base URL is set
+func (c *awsS3Client) ObjectURL(objectKey string) string {
+	if c.publicBase != "" {
+		return publicObjectURL(c.publicBase, objectKey)
+	}
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", c.bucketName, c.region, url.PathEscape(objectKey))
+}
+
+// UploadFile uploads a file to S3 and returns its URL
+func (c *awsS3Client) UploadFile(ctx context.Context, fileData []byte, fileExt string) (string, error) {
+	// Generate a unique filename
+	fileName := fmt.Sprintf("%d%s", time.Now().UnixNano(), fileExt)
+
+	return c.uploadObject(ctx, fileData, fileName, nil)
+}
+
+// UploadLocalFile uploads a local file to S3 with the given object metadata and returns its URL
+func (c *awsS3Client) UploadLocalFile(ctx context.Context, filePath string, metadata map[string]string) (string, error) {
+	fileName := fmt.Sprintf("%d%s", time.Now().UnixNano(), filepath.Ext(filePath))
+	return c.UploadLocalFileAs(ctx, filePath, fileName, metadata)
+}
+
+// UploadLocalFileAs uploads a local file to S3 under the given object key
+func (c *awsS3Client) UploadLocalFileAs(ctx context.Context, filePath string, objectKey string, metadata map[string]string) (string, error) {
+	// Read the file
+	fileData, err := os.ReadFile(filePath)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %w", err)
+	}
+
+	return c.uploadObject(ctx, fileData, objectKey, metadata)
+}
+
+// uploadObject uploads data to S3 under the given object key and returns its URL
+func (c *awsS3Client) uploadObject(ctx context.Context, fileData []byte, objectKey string, metadata map[string]string) (string, error) {
+	if err := putObject(ctx, c.s3Client, c.bucketName, objectKey, fileData, metadata); err != nil {
+		return "", fmt.Errorf("failed to upload file to S3: %w", err)
+	}
+	return c.ObjectURL(objectKey), nil
+}
@@ -0,0 +1,83 @@
+package converter
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// Supported ways of handling line breaks in note bodies
+const (
+	NewlinesPreserve = "preserve" // Keep the body as it is
+	NewlinesCollapse = "collapse" // Reduce runs of blank lines to one
+	NewlinesChildren = "children" // Turn every non-empty line into a child node
+)
+
+// validateNewlines checks that the newline handling mode is supported
+func validateNewlines(mode string) error {
+	switch mode {
+	case NewlinesPreserve, NewlinesCollapse, NewlinesChildren:
+		return nil
+	default:
+		return fmt.Errorf("invalid newline handling %q (use preserve, collapse or children)", mode)
+	}
+}
+
+// lineNodes returns a child node for every non-empty line of the content
+func lineNodes(content string) []dynalistChange {
+	var nodes []dynalistChange
+	for _, line := range strings.Split(content, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			nodes = append(nodes, dynalistChange{Content: line})
+		}
+	}
+	return nodes
+}
+
+// splitContent splits note content into parts of at most maxSize bytes, breaking
+// after a newline where possible and otherwise at a UTF-8 character boundary.
+// Content within the limit, or a limit of zero or less, yields a single part.
+func splitContent(content string, maxSize int) []string {
+	if maxSize <= 0 || len(content) <= maxSize {
+		return []string{content}
+	}
+
+	var parts []string
+	for len(content) > maxSize {
+		cut := strings.LastIndexByte(content[:maxSize], '\n') + 1
+		if cut == 0 {
+			// A single line longer than the limit, split it mid-line
+			cut = maxSize
+			for cut > 0 && !utf8.RuneStart(content[cut]) {
+				cut--
+			}
+			if cut == 0 {
+				cut = maxSize
+			}
+		}
+		parts = append(parts, strings.TrimRight(content[:cut], "\n"))
+		content = content[cut:]
+	}
+	if content != "" {
+		parts = append(parts, content)
+	}
+	return parts
+}
+
+// continuationNodes returns the Dynalist nodes holding the parts of a split note
+// after the first one, which stays in the note itself
+func continuationNodes(parts []string) []dynalistChange {
+	nodes := make([]dynalistChange, 0, len(parts)-1)
+	for i, part := range parts[1:] {
+		nodes = append(nodes, dynalistChange{
+			Content: continuationTitle(i+2, len(parts)),
+			Note:    part,
+		})
+	}
+	return nodes
+}
+
+// continuationTitle names the node holding one part of a split note
+func continuationTitle(part int, total int) string {
+	return fmt.Sprintf("(continued %d/%d)", part, total)
+}
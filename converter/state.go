@@ -0,0 +1,121 @@
+package converter
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// StateFile records the absolute paths of migrated note files, one per line,
+// so an interrupted run can be resumed without creating duplicates. With
+// idempotency markers it also records each note's marker on a "#k_" line.
+type StateFile struct {
+	mu      sync.Mutex
+	file    *os.File
+	done    map[string]bool
+	markers map[string]bool
+}
+
+// OpenStateFile loads the paths recorded in a state file and opens it for appending
+func OpenStateFile(path string) (*StateFile, error) {
+	state := &StateFile{done: make(map[string]bool), markers: make(map[string]bool)}
+
+	existing, err := os.Open(path)
+	if err == nil {
+		scanner := bufio.NewScanner(existing)
+		for scanner.Scan() {
+			line := strings.TrimSpace(scanner.Text())
+			if strings.HasPrefix(line, "#") {
+				state.markers[line] = true
+			} else if line != "" {
+				// Match IsDone, also for hand-edited files with relative or unclean paths
+				state.done[absPath(line)] = true
+			}
+		}
+		err = scanner.Err()
+		existing.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to read state file: %w", err)
+		}
+	} else if !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+
+	state.file, err = os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open state file: %w", err)
+	}
+
+	return state, nil
+}
+
+// Count returns how many note files are recorded as migrated
+func (s *StateFile) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.done)
+}
+
+// IsDone reports whether a note file was already migrated
+func (s *StateFile) IsDone(filePath string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.done[absPath(filePath)]
+}
+
+// MarkDone records a note file as migrated, writing it to disk immediately
+// so a crash loses at most the note in flight
+func (s *StateFile) MarkDone(filePath string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	path := absPath(filePath)
+	if s.done[path] {
+		return nil
+	}
+	if _, err := s.file.WriteString(path + "\n"); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	s.done[path] = true
+	return nil
+}
+
+// HasMarker reports whether a note with the given idempotency marker was already migrated
+func (s *StateFile) HasMarker(marker string) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.markers[marker]
+}
+
+// MarkMarker records the idempotency marker of a migrated note
+func (s *StateFile) MarkMarker(marker string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.markers[marker] {
+		return nil
+	}
+	if _, err := s.file.WriteString(marker + "\n"); err != nil {
+		return fmt.Errorf("failed to write state file: %w", err)
+	}
+	s.markers[marker] = true
+	return nil
+}
+
+// Close closes the state file
+func (s *StateFile) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.file.Close()
+}
+
+// absPath returns the absolute form of a path, or the path itself if that fails
+func absPath(path string) string {
+	if abs, err := filepath.Abs(path); err == nil {
+		return abs
+	}
+	return path
+}
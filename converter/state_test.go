@@ -0,0 +1,127 @@
+package converter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestStateFileConcurrentWrites(t *testing.T) {
+	const writers, notesPerWriter = 16, 50
+	path := filepath.Join(t.TempDir(), "state.txt")
+
+	state, err := OpenStateFile(path)
+	if err != nil {
+		t.Fatalf("OpenStateFile() error = %v", err)
+	}
+	var wg sync.WaitGroup
+	for w := range writers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := range notesPerWriter {
+				notePath := filepath.Join("/takeout", fmt.Sprintf("writer-%d-note-%d.json", w, n))
+				if err := state.MarkDone(notePath); err != nil {
+					t.Errorf("MarkDone() error = %v", err)
+				}
+				if err := state.MarkMarker(fmt.Sprintf("#k_%02d%08d", w, n)); err != nil {
+					t.Errorf("MarkMarker() error = %v", err)
+				}
+				state.IsDone(notePath)
+			}
+		}()
+	}
+	wg.Wait()
+	if err := state.Close(); err != nil {
+		t.Fatalf("Close() error = %v", err)
+	}
+
+	// Every entry must be on a line of its own, not interleaved with another
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	if want := 2 * writers * notesPerWriter; len(lines) != want {
+		t.Fatalf("state file has %d lines, want %d", len(lines), want)
+	}
+	for _, line := range lines {
+		if !strings.HasPrefix(line, "#k_") && !strings.HasPrefix(line, "/takeout/writer-") {
+			t.Fatalf("state file has a corrupt line %q", line)
+		}
+	}
+
+	resumed, err := OpenStateFile(path)
+	if err != nil {
+		t.Fatalf("OpenStateFile() on reopen error = %v", err)
+	}
+	defer resumed.Close()
+	if got, want := resumed.Count(), writers*notesPerWriter; got != want {
+		t.Errorf("Count() after reopen = %d, want %d", got, want)
+	}
+	if !resumed.IsDone("/takeout/writer-15-note-49.json") || !resumed.HasMarker("#k_1500000049") {
+		t.Error("reopened state file is missing entries")
+	}
+}
+
+func TestOpenStateFileNormalizesPaths(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state.txt")
+	if err := os.WriteFile(path, []byte("takeout/Keep/relative.json\n/takeout/Keep/../Keep//unclean.json\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	state, err := OpenStateFile(path)
+	if err != nil {
+		t.Fatalf("OpenStateFile() error = %v", err)
+	}
+	defer state.Close()
+	for _, notePath := range []string{"takeout/Keep/relative.json", absPath("takeout/Keep/relative.json"), "/takeout/Keep/unclean.json"} {
+		if !state.IsDone(notePath) {
+			t.Errorf("IsDone(%q) = false, want true", notePath)
+		}
+	}
+}
+
+func TestProcessFolderResumeWithWorkers(t *testing.T) {
+	const notes = 40
+	takeout := t.TempDir()
+	for i := range notes {
+		note := fmt.Sprintf(`{"title":"Note %d","textContent":"Text %d","createdTimestampUsec":1711391361446000,"userEditedTimestampUsec":1711391361446000}`, i, i)
+		if err := os.WriteFile(filepath.Join(takeout, fmt.Sprintf("note-%02d.json", i)), []byte(note), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	statePath := filepath.Join(t.TempDir(), "state.txt")
+
+	// run migrates the takeout to Markdown with concurrent workers and the state file
+	run := func(limit int) ProgressStats {
+		t.Helper()
+		state, err := OpenStateFile(statePath)
+		if err != nil {
+			t.Fatalf("OpenStateFile() error = %v", err)
+		}
+		defer state.Close()
+
+		c := newQuietConverter(t, Options{OutDir: t.TempDir(), Workers: 8, Limit: limit, State: state, Quiet: true})
+		if err := c.ProcessFolder(context.Background(), takeout); err != nil {
+			t.Fatalf("ProcessFolder() error = %v", err)
+		}
+		return c.Stats().Progress
+	}
+
+	// The first run stops at the limit, the second resumes with the rest
+	if got := run(15).ProcessedNotes; got != 15 {
+		t.Fatalf("first run processed %d notes, want 15", got)
+	}
+	second := run(0)
+	if second.ProcessedNotes != notes-15 || second.ResumedNotes != 15 {
+		t.Fatalf("second run processed %d and resumed %d notes, want %d and 15", second.ProcessedNotes, second.ResumedNotes, notes-15)
+	}
+	if third := run(0); third.ProcessedNotes != 0 || third.ResumedNotes != notes {
+		t.Fatalf("third run processed %d and resumed %d notes, want 0 and %d", third.ProcessedNotes, third.ResumedNotes, notes)
+	}
+}
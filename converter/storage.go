@@ -0,0 +1,136 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+// MediaUploader stores attachment files and returns links to them. Uploads
+// give up when their context is cancelled, e.g. when the run is interrupted.
+type MediaUploader interface {
+	// UploadLocalFile uploads a local file under a generated name
+	UploadLocalFile(ctx context.Context, filePath string, metadata map[string]string) (string, error)
+	// UploadLocalFileAs uploads a local file under the given object key
+	UploadLocalFileAs(ctx context.Context, filePath string, objectKey string, metadata map[string]string) (string, error)
+	// UploadFile uploads in-memory data under a generated name with the given extension
+	UploadFile(ctx context.Context, fileData []byte, fileExt string) (string, error)
+	// ObjectURL returns the link an object with the given key would get
+	ObjectURL(objectKey string) string
+}
+
+// Supported media backends, as given by -media or STORAGE_BACKEND
+const (
+	StorageBackendR2    = "r2"
+	StorageBackendS3    = "s3"
+	StorageBackendLocal = "local"
+)
+
+// NewMediaUploader creates the media uploader for a backend, defaulting to
+// Cloudflare R2. mediaDir is only used by the local backend. When publicBaseURL
+// is set, attachments are linked as publicBaseURL/<object key>, e.g. for a bucket
+// served through a custom domain. It returns nil when media uploads are disabled.
+func NewMediaUploader(backend string, mediaDir string, publicBaseURL string) MediaUploader {
+	backend = strings.ToLower(backend)
+
+	switch backend {
+	case StorageBackendLocal:
+		localUploader, err := newLocalUploader(mediaDir)
+		if err != nil {
+			log.Printf("Warning: Failed to initialize local media directory: %v", err)
+			log.Printf("Media uploads will be disabled")
+			return nil
+		}
+		localUploader.publicBase = publicBaseURL
+		log.Printf("Copying attachments to %s", localUploader.dir)
+		return localUploader
+
+	case StorageBackendS3:
+		s3Client, err := newS3Client()
+		if err != nil {
+			log.Printf("Warning: Failed to initialize S3 client: %v", err)
+			log.Printf("Media uploads will be disabled")
+			return nil
+		}
+		s3Client.publicBase = publicBaseURL
+		log.Printf("S3 client initialized successfully")
+		return s3Client
+
+	case "", StorageBackendR2:
+		// Without any R2 settings media is simply off, but a partial setup is a mistake
+		if len(missingEnvVars(r2EnvVars)) == len(r2EnvVars) {
+			log.Printf("Cloudflare R2 environment variables not set, media uploads will be disabled")
+			return nil
+		}
+		r2Client, err := newCloudflareR2Client()
+		if err != nil {
+			log.Printf("Warning: Failed to initialize Cloudflare R2 client: %v", err)
+			log.Printf("Media uploads will be disabled")
+			return nil
+		}
+		r2Client.publicBase = publicBaseURL
+		log.Printf("Cloudflare R2 client initialized successfully")
+		return r2Client
+
+	default:
+		log.Printf("Warning: Unknown media backend %q, media uploads will be disabled", backend)
+		return nil
+	}
+}
+
+// r2EnvVars lists the environment variables the Cloudflare R2 backend requires
+var r2EnvVars = []string{"CF_ACCOUNT_ID", "CF_ACCESS_KEY_ID", "CF_ACCESS_KEY_SECRET", "CF_BUCKET_NAME"}
+
+// missingEnvVars returns the names of the given environment variables that are unset or empty
+func missingEnvVars(names []string) []string {
+	var missing []string
+	for _, name := range names {
+		if os.Getenv(name) == "" {
+			missing = append(missing, name)
+		}
+	}
+	return missing
+}
+
+// ValidatePublicBaseURL checks that a public base URL is an absolute http(s) URL
+func ValidatePublicBaseURL(publicBaseURL string) error {
+	u, err := url.Parse(publicBaseURL)
+	if err != nil {
+		return fmt.Errorf("invalid public base URL: %w", err)
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid public base URL %q, expected an http or https URL", publicBaseURL)
+	}
+	return nil
+}
+
+// publicObjectURL returns the URL of an object under a public base URL
+func publicObjectURL(publicBaseURL string, objectKey string) string {
+	return strings.TrimRight(publicBaseURL, "/") + "/" + url.PathEscape(objectKey)
+}
+
+// putObject uploads data to an S3-compatible bucket, detecting its content type
+func putObject(ctx context.Context, client *s3.Client, bucketName string, objectKey string, fileData []byte, metadata map[string]string) error {
+	// Detect content type
+	contentType := http.DetectContentType(fileData)
+
+	_, err := client.PutObject(ctx, &s3.PutObjectInput{
+		Bucket:      aws.String(bucketName),
+		Key:         aws.String(objectKey),
+		Body:        bytes.NewReader(fileData),
+		ContentType: aws.String(contentType),
+		Metadata:    metadata,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to upload file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package converter
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// countTags records the hashtags of a migrated note
+func (c *Converter) countTags(hashtags string) {
+	c.updateStats(func(s *RunStats) {
+		for _, tag := range strings.Fields(hashtags) {
+			s.TagCounts[tag]++
+		}
+	})
+}
+
+// WriteTagReport writes every hashtag generated so far and its note count to
+// a CSV file, most frequently used tags first
+func (c *Converter) WriteTagReport(path string) error {
+	counts := c.Stats().TagCounts
+	tags := make([]string, 0, len(counts))
+	for tag := range counts {
+		tags = append(tags, tag)
+	}
+	sort.Slice(tags, func(i, j int) bool {
+		if counts[tags[i]] != counts[tags[j]] {
+			return counts[tags[i]] > counts[tags[j]]
+		}
+		return tags[i] < tags[j]
+	})
+
+	file, err := os.Create(path)
+	if err != nil {
+		return fmt.Errorf("failed to create tag report: %w", err)
+	}
+	defer file.Close()
+
+	writer := csv.NewWriter(file)
+	writer.Write([]string{"tag", "notes"})
+	for _, tag := range tags {
+		writer.Write([]string{tag, strconv.Itoa(counts[tag])})
+	}
+	writer.Flush()
+	if err := writer.Error(); err != nil {
+		return fmt.Errorf("failed to write tag report: %w", err)
+	}
+
+	return nil
+}
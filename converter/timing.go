@@ -0,0 +1,43 @@
+package converter
+
+import (
+	"log/slog"
+	"time"
+)
+
+// noteTiming records how long the phases of migrating one note took
+type noteTiming struct {
+	parse  time.Duration // Reading and decoding the note file
+	upload time.Duration // Uploading its attachments
+	add    time.Duration // Adding it to Dynalist, or writing it to OutDir
+}
+
+// TimingStats sums up the phase timings of migrated notes, only collected
+// with Options.Profile
+type TimingStats struct {
+	Notes  int // Migrated notes the sums cover
+	Parse  time.Duration
+	Upload time.Duration
+	Add    time.Duration
+}
+
+// Average returns the mean of a phase's total over the migrated notes
+func (s TimingStats) Average(total time.Duration) time.Duration {
+	if s.Notes == 0 {
+		return 0
+	}
+	return total / time.Duration(s.Notes)
+}
+
+// recordTiming logs the timing of a migrated note and adds it to the statistics
+func (c *Converter) recordTiming(t *noteTiming, filePath string, title string) {
+	slog.Info("Note timing", "file", filePath, "title", title,
+		"parse", t.parse.Round(time.Microsecond), "upload", t.upload.Round(time.Microsecond),
+		"add", t.add.Round(time.Microsecond), "total", (t.parse + t.upload + t.add).Round(time.Microsecond))
+	c.updateStats(func(s *RunStats) {
+		s.Timings.Notes++
+		s.Timings.Parse += t.parse
+		s.Timings.Upload += t.upload
+		s.Timings.Add += t.add
+	})
+}
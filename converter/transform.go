@@ -0,0 +1,93 @@
+package converter
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Supported ways of handling a transform command that fails
+const (
+	TransformFailNote = "fail" // Fail the note, so it is retried and reported like other failures
+	TransformSkipNote = "skip" // Skip the note and go on
+)
+
+// transformTimeout bounds how long the transform command may take per note
+const transformTimeout = 30 * time.Second
+
+// errTransformSkipped is returned by processMessage for notes whose transform
+// failed under the skip policy
+var errTransformSkipped = errors.New("transform command failed, note skipped")
+
+// transformInput is the JSON the transform command reads on stdin
+type transformInput struct {
+	File    string    `json:"file"`
+	Title   string    `json:"title"`   // Title as it would be sent, with prefix and tags
+	Content string    `json:"content"` // Note body as it would be sent
+	Note    *KeepNote `json:"note"`    // The Keep note as exported
+}
+
+// transformOutput is the JSON the transform command writes to stdout.
+// Fields it leaves out keep their value.
+type transformOutput struct {
+	Title   *string `json:"title"`
+	Content *string `json:"content"`
+}
+
+// validateTransform checks that the transform command can be found and the
+// failure policy is supported
+func validateTransform(command string, policy string) error {
+	if policy != TransformFailNote && policy != TransformSkipNote {
+		return fmt.Errorf("invalid transform failure policy %q (use fail or skip)", policy)
+	}
+	if args := strings.Fields(command); len(args) > 0 {
+		if _, err := exec.LookPath(args[0]); err != nil {
+			return fmt.Errorf("transform command not found: %w", err)
+		}
+	}
+	return nil
+}
+
+// transform runs TransformCmd on a note and returns the title and content it
+// produced. The command is split on white space and run without a shell.
+func (c *Converter) transform(ctx context.Context, note *KeepNote, filePath string, title string, content string) (string, string, error) {
+	input, err := json.Marshal(transformInput{File: filePath, Title: title, Content: content, Note: note})
+	if err != nil {
+		return "", "", fmt.Errorf("failed to encode note for transform command: %w", err)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, transformTimeout)
+	defer cancel()
+	args := strings.Fields(c.opts.TransformCmd)
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(input)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if detail := strings.TrimSpace(stderr.String()); detail != "" {
+			err = fmt.Errorf("%w: %s", err, detail)
+		}
+		return "", "", fmt.Errorf("transform command failed: %w", err)
+	}
+
+	var output transformOutput
+	if err := json.Unmarshal(stdout.Bytes(), &output); err != nil {
+		return "", "", fmt.Errorf("transform command returned invalid JSON: %w", err)
+	}
+	if output.Title != nil {
+		title = *output.Title
+	}
+	if output.Content != nil {
+		content = *output.Content
+	}
+	if strings.TrimSpace(title) == "" {
+		return "", "", fmt.Errorf("transform command returned an empty title")
+	}
+	return title, content, nil
+}
@@ -0,0 +1,39 @@
+package converter
+
+import (
+	"context"
+	"log"
+)
+
+// UploadStats counts the attachment uploads of a run
+type UploadStats struct {
+	Successful   int
+	Failed       int // Uploads that failed on every attempt
+	Retries      int
+	Deduplicated int // Uploads avoided because the same file was already uploaded
+}
+
+// uploadWithRetry runs an upload, retrying it up to UploadRetries times with
+// the same exponential backoff as Dynalist API calls. It gives up as soon as
+// the context is cancelled, including while waiting to retry.
+func (c *Converter) uploadWithRetry(ctx context.Context, upload func() (string, error)) (string, error) {
+	for attempt := 0; ; attempt++ {
+		uploadURL, err := upload()
+		if err == nil {
+			c.updateStats(func(s *RunStats) { s.Uploads.Successful++ })
+			return uploadURL, nil
+		}
+		if attempt >= c.opts.UploadRetries || ctx.Err() != nil {
+			c.updateStats(func(s *RunStats) { s.Uploads.Failed++ })
+			return "", err
+		}
+
+		delay := calculateBackoff(attempt, c.opts.Retry)
+		log.Printf("Warning: attachment upload failed, retrying in %v (%d/%d): %v", delay, attempt+1, c.opts.UploadRetries, err)
+		c.updateStats(func(s *RunStats) { s.Uploads.Retries++ })
+		if err := sleepContext(ctx, delay); err != nil {
+			c.updateStats(func(s *RunStats) { s.Uploads.Failed++ })
+			return "", err
+		}
+	}
+}
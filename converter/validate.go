@@ -0,0 +1,129 @@
+package converter
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+)
+
+// DefaultMaxNoteSize is the largest note body we expect Dynalist to accept;
+// longer notes are split across continuation nodes
+const DefaultMaxNoteSize = 64 * 1024
+
+// ValidationReport aggregates the problems found in a takeout folder. Problems
+// keep notes from migrating as they are; warnings only point out notes that are
+// migrated differently than they look in Keep.
+type ValidationReport struct {
+	CheckedNotes       int
+	IgnoredFiles       []string // Not Keep notes at all, so not counted as problems
+	ParseErrors        []string
+	MissingAttachments []string
+	EmptyItems         []string // Notes whose formatted Dynalist item has no text
+
+	EmptyNotes     []string // Warnings: skipped unless IncludeEmpty
+	OversizedNotes []string // Warnings: split across continuation nodes
+}
+
+// ProblemCount returns the total number of problems found
+func (r *ValidationReport) ProblemCount() int {
+	return len(r.ParseErrors) + len(r.MissingAttachments) + len(r.EmptyItems)
+}
+
+// WarningCount returns the total number of warnings
+func (r *ValidationReport) WarningCount() int {
+	return len(r.EmptyNotes) + len(r.OversizedNotes)
+}
+
+// Validate runs the parse, attachment-resolution and formatting steps for every
+// note in the takeout folders without making any network calls. Link titles
+// aren't fetched and the transform command isn't run, so the formatted output
+// is checked as it is before those steps.
+func (c *Converter) Validate(folderPaths ...string) (*ValidationReport, error) {
+	report := &ValidationReport{}
+
+	for _, folderPath := range folderPaths {
+		err := c.walkTakeout(folderPath, func(filePath string, isDir bool) error {
+			// Process only JSON files
+			if isDir || filepath.Ext(filePath) != ".json" {
+				return nil
+			}
+
+			// Files holding an array of notes are checked note by note
+			isArray, err := c.streamNoteArray(filePath, func(element int, note *KeepNote, err error) bool {
+				c.validateNote(report, folderPath, noteFile{path: filePath, element: element}.id(), note, err)
+				return true
+			})
+			if isArray {
+				if err != nil {
+					log.Printf("Unparseable notes %s: %v", filePath, err)
+					report.ParseErrors = append(report.ParseErrors, filePath)
+				}
+				return nil
+			}
+
+			note, err := c.parseKeepNote(filePath, c.opts.MaxFileSize)
+			c.validateNote(report, folderPath, filePath, note, err)
+			return nil
+		})
+		if err != nil {
+			return report, err
+		}
+	}
+
+	return report, nil
+}
+
+// validateNote checks a parsed note, or the error parsing it, adding its
+// problems to the report
+func (c *Converter) validateNote(report *ValidationReport, folderPath string, filePath string, note *KeepNote, err error) {
+	report.CheckedNotes++
+
+	if errors.Is(err, ErrNotKeepNote) {
+		log.Printf("Not a Keep note %s: %v", filePath, err)
+		report.IgnoredFiles = append(report.IgnoredFiles, filePath)
+		return
+	}
+	if err != nil {
+		log.Printf("Unparseable note %s: %v", filePath, err)
+		report.ParseErrors = append(report.ParseErrors, filePath)
+		return
+	}
+
+	// Skipped notes are not migrated, so their problems don't matter
+	if (note.IsArchived && !c.opts.IncludeArchived) || (note.IsTrashed && !c.opts.IncludeTrashed) {
+		return
+	}
+
+	if isEmptyNote(note) && !c.opts.IncludeEmpty {
+		log.Printf("Empty note %s, it will be skipped", filePath)
+		report.EmptyNotes = append(report.EmptyNotes, filePath)
+		return
+	}
+
+	var attachmentLinks []string
+	for _, attachment := range note.Attachments {
+		if _, err := c.findAttachmentFile(folderPath, attachment.FilePath); err != nil {
+			log.Printf("Missing attachment in %s: %v", filePath, err)
+			report.MissingAttachments = append(report.MissingAttachments, filePath+": "+attachment.FilePath)
+			continue
+		}
+		if c.opts.Uploader != nil {
+			name := attachment.FilePath
+			attachmentLinks = append(attachmentLinks, fmt.Sprintf("[%s](%s)", name, c.opts.Uploader.ObjectURL(name)))
+		}
+	}
+
+	// Check the text as it would be sent
+	title, noteContent := c.noteText(note, folderPath, filePath, c.buildBaseTitle(note, filePath), attachmentLinks)
+	content, body := c.opts.Formatter(title, noteContent)
+	if strings.TrimSpace(content) == "" {
+		log.Printf("Note %s would become an item without text", filePath)
+		report.EmptyItems = append(report.EmptyItems, filePath)
+	}
+	if c.opts.Newlines != NewlinesChildren && len(body) > c.opts.MaxNoteSize {
+		log.Printf("Oversized note %s: %d bytes, it will be split", filePath, len(body))
+		report.OversizedNotes = append(report.OversizedNotes, filePath)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Supported values of the -log-format flag
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// setupJSONLogging routes all log output, including plain log.Printf calls,
+// through a JSON handler writing one object per line to w, dropping records below level
+func setupJSONLogging(w io.Writer, level slog.Level) {
+	slog.SetDefault(slog.New(levelHandler{slog.NewJSONHandler(w, &slog.HandlerOptions{Level: level})}))
+}
+
+// validateLogFormat checks the value of the -log-format flag
+func validateLogFormat(format string) error {
+	if format != LogFormatText && format != LogFormatJSON {
+		return fmt.Errorf("invalid log format %q, expected text or json", format)
+	}
+	return nil
+}
+
+// levelHandler derives the level of messages logged with log.Printf, which all
+// arrive at INFO, from how they start, e.g. "Warning: ..." or "Failed to ..."
+type levelHandler struct {
+	slog.Handler
+}
+
+func (h levelHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level == slog.LevelInfo {
+		r.Level = messageLevel(r.Message)
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return levelHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h levelHandler) WithGroup(name string) slog.Handler {
+	return levelHandler{h.Handler.WithGroup(name)}
+}
+
+// messageLevel guesses the level of a plain log message from its wording
+func messageLevel(message string) slog.Level {
+	switch {
+	case strings.HasPrefix(message, "Error"), strings.HasPrefix(message, "Failed"):
+		return slog.LevelError
+	case strings.HasPrefix(message, "Warning"):
+		return slog.LevelWarn
+	default:
+		return slog.LevelInfo
+	}
+}
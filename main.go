@@ -1,263 +1,604 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
+	"log/slog"
 	"math/rand"
 	"os"
+	"os/signal"
 	"path/filepath"
 	"strings"
+	"syscall"
 	"time"
-)
-
-// ProgressStats tracks processing progress
-type ProgressStats struct {
-	TotalNotes     int
-	ProcessedNotes int
-	SkippedNotes   int
-	StartTime      time.Time
-}
 
-// Global progress statistics
-var Progress ProgressStats
+	"github.com/korjavin/gkeep2dynalist/converter"
+)
 
 func init() {
 	// Seed the random number generator
 	rand.Seed(time.Now().UnixNano())
-
-	// Initialize progress tracking
-	Progress = ProgressStats{
-		StartTime: time.Now(),
-	}
 }
 
 func main() {
+	os.Exit(run())
+}
+
+// run migrates the takeout as the flags say and returns the exit code. Errors
+// return instead of exiting so the deferred cleanup, e.g. closing the takeout
+// archives and the log file, always runs.
+func run() int {
 	// Define command-line flags
-	takeoutPath := flag.String("takeout", "", "Path to the Google Keep takeout folder")
+	var takeoutPaths stringList
+	flag.Var(&takeoutPaths, "takeout", "Path to a Google Keep takeout folder; repeat or separate with commas to migrate several in one run")
+	Opts.Retry = converter.DefaultRetryConfig()
+	flag.IntVar(&Opts.Retry.MaxRetries, "max-retries", Opts.Retry.MaxRetries, "Maximum number of retries per Dynalist API call")
+	flag.DurationVar(&Opts.Retry.MinDelay, "min-delay", Opts.Retry.MinDelay, "Minimum backoff delay between retries")
+	flag.DurationVar(&Opts.Retry.MaxDelay, "max-delay", Opts.Retry.MaxDelay, "Maximum backoff delay between retries")
+	flag.DurationVar(&Opts.Retry.MinPause, "min-pause", Opts.Retry.MinPause, "Minimum random pause between Dynalist API calls")
+	flag.DurationVar(&Opts.Retry.MaxPause, "max-pause", Opts.Retry.MaxPause, "Maximum random pause between Dynalist API calls")
+	flag.IntVar(&Opts.Retry.Rate, "rate", 0, "Limit Dynalist API calls to this many per minute across all workers instead of pausing randomly (0 to pause randomly)")
+	flag.IntVar(&Opts.UploadRetries, "upload-retries", 3, "Maximum number of retries per attachment upload")
+	flag.IntVar(&Opts.MaxNoteSize, "max-note-size", converter.DefaultMaxNoteSize, "Split note bodies longer than this many bytes across continuation child nodes")
+	flag.IntVar(&Opts.Limit, "limit", 0, "Stop after migrating this many notes, e.g. to try settings on a few notes (0 for no limit)")
+	flag.IntVar(&Opts.Workers, "workers", 1, "Number of notes processed concurrently (higher values risk Dynalist rate limiting)")
+	flag.IntVar(&Opts.AttachmentNoteWorkers, "attachment-note-workers", 0, "Number of notes with attachments processed concurrently, at most -workers (0 for -workers)")
+	flag.IntVar(&Opts.BatchSize, "batch-size", 1, "With -doc-id, add up to this many notes per API call; batches hold at most -workers notes")
+	flag.BoolVar(&Opts.IncludeArchived, "include-archived", false, "Migrate archived notes too")
+	flag.BoolVar(&Opts.IncludeTrashed, "include-trashed", false, "Migrate trashed notes too")
+	flag.BoolVar(&Opts.IncludeEmpty, "include-empty", false, "Migrate notes without any title, text, checklist items or attachments too")
+	flag.BoolVar(&Opts.SkipDuplicates, "skip-duplicates", false, "Skip notes with the same title, text and attachments as a note earlier in the run")
+	flag.BoolVar(&Opts.DuplicateWhitespace, "duplicate-whitespace", false, "With -skip-duplicates, treat notes that only differ in whitespace as different")
+	flag.BoolVar(&Opts.DuplicateTimestamps, "duplicate-timestamps", false, "With -skip-duplicates, only treat notes created at the same time as duplicates")
+	flag.BoolVar(&Opts.IncludeSharees, "include-sharees", false, "Add \"Shared with: ...\" listing the collaborators of shared notes to the note body")
+	flag.BoolVar(&Opts.RedactSharees, "redact-sharees", false, "With -include-sharees, list collaborators by a short hash of their email address")
+	flag.BoolVar(&Opts.NoTimestamps, "no-timestamps", false, "Don't add the created and last-edited dates to the note body")
+	flag.StringVar(&Opts.TimestampFormat, "timestamp-format", time.RFC3339, "Go time layout used for the created and last-edited dates")
+	timezone := flag.String("timezone", "", "IANA time zone, e.g. Europe/Madrid, for the note dates and -since/-until (defaults to the local one)")
+	since := flag.String("since", "", "Only migrate notes created on or after this date (YYYY-MM-DD)")
+	until := flag.String("until", "", "Only migrate notes created on or before this date (YYYY-MM-DD)")
+	flag.Var((*stringList)(&Opts.Labels), "label", "Only migrate notes with this label (repeatable or comma-separated, case-insensitive)")
+	flag.StringVar(&Opts.DocID, "doc-id", "", "Add notes to this Dynalist document (file ID) instead of the inbox")
+	flag.StringVar(&Opts.ParentNode, "parent-node", "", "Node of the -doc-id document to add notes under (defaults to the document root)")
+	flag.BoolVar(&Opts.DayHeaders, "day-headers", false, "With -doc-id, add notes oldest first with a \"— 2024-03-25 —\" header node before each day's notes (processes one note at a time)")
+	flag.StringVar(&Opts.RootNode, "root-node", "", "With -doc-id, create a node with this title under -parent-node and add every note as its child, e.g. \"Keep Import\"")
+	flag.Var((*labelColors)(&Opts.LabelColors), "label-color", "With -doc-id, color the nodes of notes with a label, as Label=color with red, orange, yellow, green, blue or purple (repeatable, the first matching label wins)")
+	flag.StringVar(&Opts.OutDir, "out-dir", "", "Write notes as Markdown files into this directory instead of sending them to Dynalist")
+	flag.BoolVar(&Opts.AsCheckbox, "as-checkbox", false, "Create every note as a Dynalist checkbox item, checked for archived and trashed notes and completed checklists")
+	flag.BoolVar(&Opts.RemindersAsTasks, "reminders-as-tasks", false, "Create notes with a future reminder as checkbox items with the reminder as Dynalist due date")
+	flag.BoolVar(&Opts.DryRun, "dry-run", false, "Log what would be sent instead of uploading attachments or calling the Dynalist API")
+	flag.BoolVar(&Opts.IdempotencyMarkers, "idempotency-markers", false, "Tag each note with a marker derived from its creation time and content (#k_xxxxxxxxxx) and skip notes whose marker the state file lists")
+	flag.BoolVar(&Opts.SkipExisting, "skip-existing", false, "Read the -doc-id document first and skip notes whose idempotency marker it already contains")
+	flag.BoolVar(&Opts.EmbedContentHash, "embed-content-hash", false, "Append a short content hash tag (#h_xxxxxxxx) to each note title")
+	flag.BoolVar(&Opts.FlattenAttachments, "flatten-attachments", false, "Link image attachments as inline images (![name](url)) instead of plain links")
+	flag.BoolVar(&Opts.AttachmentGallery, "attachment-gallery", false, "Link a single uploaded HTML gallery page instead of one link per attachment")
+	flag.Var((*stringList)(&Opts.AttachmentTypes), "attachment-types", "Only upload attachments of these MIME types, e.g. image/* (repeatable or comma-separated)")
+	flag.Var((*stringList)(&Opts.SkipAttachmentTypes), "skip-attachment-types", "Don't upload attachments of these MIME types, e.g. video/* (repeatable or comma-separated)")
+	maxAttachmentSize := flag.Int64("max-attachment-size", 0, "Don't upload attachments larger than this many megabytes (0 for no limit)")
+	maxFileSize := flag.Int64("max-file-size", converter.DefaultMaxFileSize/1024/1024, "Reject note JSON files larger than this many megabytes instead of reading them (0 for no limit)")
+	flag.BoolVar(&Opts.RenameAttachments, "rename-attachments", false, "Name uploaded attachments after the note title plus an index (e.g. meeting-notes-1.jpg)")
+	flag.StringVar(&Opts.UniqueTitles, "unique-titles", "", "Tell apart notes whose title an earlier note already has by appending its creation date (date) or a number (counter)")
+	flag.StringVar(&Opts.NormalizeUnicode, "normalize-unicode", "", "Unicode normalization applied to titles and content: nfc (compose accents) or nfkc (also full-width and other compatibility characters); empty for none")
+	flag.StringVar(&Opts.TransformCmd, "transform-cmd", "", "Command that reads each note as JSON on stdin and writes {\"title\": ..., \"content\": ...} to stdout to rewrite it")
+	flag.StringVar(&Opts.TransformFailure, "transform-on-error", converter.TransformFailNote, "What a failing -transform-cmd does to the note: fail (retry and report it) or skip")
+	flag.StringVar(&Opts.FieldMapping, "field-mapping", converter.FieldMappingTitle, "Which note fields become the Dynalist item and its note: title (title as item, text as note), swap (text as item, title as note) or merged (both in the item)")
+	flag.StringVar(&Opts.Newlines, "replace-newlines", converter.NewlinesPreserve, "How line breaks in note bodies are handled: preserve, collapse (one blank line at most) or children (one child item per line)")
+	flag.StringVar(&Opts.TagsPosition, "tags-position", converter.TagsPositionTitle, "Where tags go: title, note-top or note-bottom")
+	flag.StringVar(&Opts.TagSeparator, "tag-separator", converter.TagSeparatorUnderscore, "How words of multi-word labels are joined in tags: underscore, dash, camel or remove")
+	flag.StringVar(&Opts.TagCase, "tag-case", converter.TagCasePreserve, "Casing of label tags: preserve, lower or upper")
+	flag.Var((*labelMap)(&Opts.LabelMap), "map-label", "Rename a label before it becomes a tag, as From=To with the exact original label name (repeatable)")
+	flag.StringVar(&Opts.TitlePrefix, "title-prefix", "gkeep: ", "Prefix of every Dynalist item title (empty for none)")
+	flag.StringVar(&Opts.AttachmentsHeader, "attachments-header", "Attachments:", "Line introducing the attachment links in the note body (empty for none)")
+	flag.BoolVar(&Opts.NoColorTags, "no-color-tags", false, "Don't tag notes with their Keep color")
+	flag.StringVar(&Opts.TagPrefix, "tag-prefix", "", "Namespace prepended to every generated tag, e.g. keep for #keep_Work (empty for none)")
+	flag.StringVar(&Opts.TagPrefixSeparator, "tag-prefix-separator", "_", "Separator between -tag-prefix and the tag, made of characters allowed in tags (letters, digits, _ and -)")
+	flag.StringVar(&Opts.ColorTagPrefix, "color-tag-prefix", "color_", "Prefix of the tags generated from note colors")
+	flag.StringVar(&Opts.PinnedTag, "pinned-tag", "pinned", "Tag added to notes pinned in Keep (empty for none)")
+	flag.BoolVar(&Opts.FoldersAsTags, "folders-as-tags", false, "Add a tag for each folder between the takeout folder and the note")
+	flag.BoolVar(&Opts.AbortOnMissingAttachment, "abort-on-missing-attachment", false, "Fail a note instead of sending it without an attachment that can't be found")
+	flag.IntVar(&Opts.FilenameTitleLength, "filename-title-length", converter.DefaultFilenameTitleLength, "Characters of the file name kept when titling untitled notes without any text")
+	flag.IntVar(&Opts.ContentTitleLength, "content-title-length", converter.DefaultContentTitleLength, "Characters of the first line of text kept when titling untitled notes")
+	flag.BoolVar(&Opts.PreferHTMLTitle, "prefer-html-title", false, "Use the first heading of the note HTML as the title for untitled notes")
+	flag.BoolVar(&Opts.FetchURLTitles, "fetch-url-titles", false, "Fetch the page title of notes that contain only a URL and use it as the note title")
+	media := flag.String("media", "", "Media backend for attachments: r2, s3 or local (defaults to STORAGE_BACKEND, then r2)")
+	mediaDir := flag.String("media-dir", "", "Directory attachments are copied into by the local media backend (defaults to MEDIA_DIR)")
+	publicBaseURL := flag.String("public-base-url", "", "Link attachments as this URL followed by the object key, e.g. a custom domain serving the bucket (defaults to PUBLIC_BASE_URL)")
+	printConfig := flag.Bool("print-config", false, "Print the effective configuration (secrets redacted) at startup")
+	keepSubdir := flag.String("keep-subdir", "Keep", "Only process this subdirectory of the takeout when it exists (empty to process the whole folder)")
+	maxPerRun := flag.Int("max-per-run", 0, "With -state, migrate at most this many notes the state file doesn't list yet, to spread a migration over several runs (0 for no limit)")
+	stateFile := flag.String("state", "", "State file recording migrated notes; notes listed in it are skipped on re-runs")
+	previousTakeout := flag.String("previous-takeout", "", "Path to an earlier takeout; only notes that are new or changed relative to it are migrated")
+	validateOnly := flag.Bool("validate-only", false, "Check the takeout for problems without sending anything, exiting non-zero if any problems or warnings are found")
+	allowWarnings := flag.Bool("allow-warnings", false, "With -validate-only, only fail on problems, not on empty or oversized notes")
+	tokenFile := flag.String("token-file", "", "Read the Dynalist token from this file, e.g. a Docker secret, instead of DYNALIST_TOKEN")
+	envFile := flag.String("env-file", "", "Load environment variables from this file (defaults to .env in the working directory if present)")
+	failuresFile := flag.String("failures", "", "Write the paths of notes that failed even on the retry pass to this file, one per line")
+	runReport := flag.String("report", "", "Write a summary of the run to this file, as Markdown if it ends in .md and JSON otherwise")
+	metricsAddr := flag.String("metrics-addr", "", "Serve progress, API and upload counters as Prometheus metrics on this address, e.g. :9090")
+	tagReport := flag.String("tag-report", "", "Write a CSV of every generated tag and the number of notes using it to this file")
+	confirmThreshold := flag.Int("confirm-threshold", 500, "Ask for confirmation before sending more than this many notes")
+	assumeYes := flag.Bool("yes", false, "Don't ask for confirmation before large runs")
+	strict := flag.Bool("strict", false, "Exit with status 2 on any failed API call or upload, even when a retry succeeded, instead of only when notes failed")
+	logFile := flag.String("log-file", "", "Write log output to this file instead of the terminal")
+	verbose := flag.Bool("v", false, "Verbose: also log why each note was skipped and each migrated note")
+	flag.BoolVar(&Opts.Profile, "profile", false, "Log how long parsing, attachment uploads and adding to Dynalist took for each note, and the averages at the end")
+	flag.BoolVar(&Opts.Quiet, "q", false, "Quiet: only show the progress bar, problems and the final summary")
+	logFormat := flag.String("log-format", LogFormatText, "Log output format: text, or json for one structured object per line")
+	logMaxSize := flag.Int64("log-max-size", 10, "Rotate the log file once it exceeds this many megabytes (0 disables rotation)")
+	configFile := flag.String("config", "", "Read settings from this TOML file: flag names as keys and environment variables in an [env] table; command-line flags win")
 	flag.Parse()
 
-	// Validate command-line arguments
-	if *takeoutPath == "" {
-		log.Fatal("Usage: gkeep2dynalist -takeout <takeout_path>")
+	// Fill in the flags not given on the command line from the config file
+	if *configFile != "" {
+		if err := loadConfigFile(*configFile); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+	}
+	Opts.MaxAttachmentSize = *maxAttachmentSize * 1024 * 1024
+	Opts.MaxFileSize = *maxFileSize * 1024 * 1024
+	if *maxFileSize == 0 {
+		Opts.MaxFileSize = -1 // No limit
+	}
+	if err := parseDateOptions(*timezone, *since, *until); err != nil {
+		log.Printf("Error: %v", err)
+		return 1
 	}
 
-	// Validate that the provided path exists and is a directory
-	fileInfo, err := os.Stat(*takeoutPath)
-	if err != nil {
-		log.Fatalf("Error: %v", err)
+	exitCode := 0
+
+	// Send log output to a file so the progress bar keeps the terminal clean
+	if *logFile != "" {
+		logWriter, err := NewRotatingFile(*logFile, *logMaxSize*1024*1024)
+		if err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+		defer logWriter.Close()
+		log.SetOutput(logWriter)
+	}
+
+	// Emit structured logs and progress events for scripts and log aggregators
+	if err := validateLogFormat(*logFormat); err != nil {
+		log.Printf("Error: %v", err)
+		return 1
+	}
+	if *verbose && Opts.Quiet {
+		log.Print("Error: -v and -q can't be combined")
+		return 1
 	}
-	if !fileInfo.IsDir() {
-		log.Fatalf("Error: %s is not a directory", *takeoutPath)
+	level := slog.LevelInfo
+	if *verbose {
+		level = slog.LevelDebug
+	}
+	if *logFormat == LogFormatJSON {
+		setupJSONLogging(log.Writer(), level)
+		Opts.JSONProgress = true
+	} else {
+		slog.SetLogLoggerLevel(level)
 	}
 
-	// Get environment variables
-	dynalistToken := os.Getenv("DYNALIST_TOKEN")
+	// Stop the migration cleanly on SIGINT/SIGTERM; a second signal quits immediately
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	finished := make(chan struct{})
+	defer close(finished) // Runs before stop, so returning isn't taken for an interrupt
+	go func() {
+		<-ctx.Done()
+		select {
+		case <-finished:
+			return
+		default:
+		}
+		log.Printf("Interrupted, finishing in-flight requests (interrupt again to quit immediately)")
+		stop()
+	}()
+
+	// Load variables from a .env file, defaulting to one in the working directory
+	if *envFile != "" {
+		if err := loadEnvFile(*envFile); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+	} else if _, err := os.Stat(".env"); err == nil {
+		if err := loadEnvFile(".env"); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+	}
 
-	// Validate environment variables
-	if dynalistToken == "" {
-		log.Fatal("DYNALIST_TOKEN environment variables must be set")
+	if *printConfig {
+		logConfig()
 	}
 
-	// Initialize Cloudflare R2 client if environment variables are set
-	var r2Client *CloudflareR2Client
-	if os.Getenv("CF_ACCOUNT_ID") != "" {
-		r2Client, err = NewCloudflareR2Client()
+	// Validate command-line arguments
+	if len(takeoutPaths) == 0 {
+		log.Print("Usage: gkeep2dynalist -takeout <takeout_path>")
+		return 1
+	}
+
+	// Migrating in chunks relies on the state file to pick up where the last run stopped
+	if *maxPerRun > 0 {
+		if *stateFile == "" {
+			log.Print("Error: -max-per-run requires -state to remember the notes earlier runs migrated")
+			return 1
+		}
+		if Opts.Limit == 0 || *maxPerRun < Opts.Limit {
+			Opts.Limit = *maxPerRun
+		}
+	}
+
+	// Get the token, preferring a token file to the environment
+	Opts.Token = os.Getenv("DYNALIST_TOKEN")
+	if *tokenFile != "" {
+		token, err := readTokenFile(*tokenFile)
 		if err != nil {
-			log.Printf("Warning: Failed to initialize Cloudflare R2 client: %v", err)
-			log.Printf("Media uploads will be disabled")
-		} else {
-			log.Printf("Cloudflare R2 client initialized successfully")
+			log.Printf("Error: %v", err)
+			return 1
 		}
-	} else {
-		log.Printf("Cloudflare R2 environment variables not set, media uploads will be disabled")
+		Opts.Token = token
 	}
 
-	// Count total notes first
-	countJsonFiles(*takeoutPath)
-	log.Printf("Found %d total JSON files to process", Progress.TotalNotes)
+	if !*validateOnly {
+		// Initialize the media uploader selected by -media or STORAGE_BACKEND
+		if *media == "" {
+			*media = os.Getenv("STORAGE_BACKEND")
+		}
+		if *mediaDir == "" {
+			*mediaDir = os.Getenv("MEDIA_DIR")
+		}
+		if *publicBaseURL == "" {
+			*publicBaseURL = os.Getenv("PUBLIC_BASE_URL")
+		}
+		if *publicBaseURL != "" {
+			if err := converter.ValidatePublicBaseURL(*publicBaseURL); err != nil {
+				log.Printf("Error: %v", err)
+				return 1
+			}
+		}
+		Opts.Uploader = converter.NewMediaUploader(*media, *mediaDir, *publicBaseURL)
 
-	// Process Google Keep folder
-	err = processKeepFolder(*takeoutPath, dynalistToken, r2Client)
+		// Create the Markdown output directory
+		if Opts.OutDir != "" {
+			if err := os.MkdirAll(Opts.OutDir, 0755); err != nil {
+				log.Printf("Error: failed to create output directory: %v", err)
+				return 1
+			}
+		}
+
+		// Load the state file of earlier runs to skip already migrated notes
+		if *stateFile != "" {
+			state, err := converter.OpenStateFile(*stateFile)
+			if err != nil {
+				log.Printf("Error: %v", err)
+				return 1
+			}
+			defer state.Close()
+			Opts.State = state
+			logInfo("State file lists %d already migrated notes", state.Count())
+		}
+	}
+
+	// Check the conversion options before touching the takeout
+	conv, err := converter.New(Opts)
 	if err != nil {
-		log.Fatalf("Error processing Google Keep folder: %v", err)
+		log.Printf("Error: %v", err)
+		return 1
 	}
+	defer conv.Close()
+	logInfo("Run ID: %s", conv.RunID())
 
-	// Display final statistics
-	duration := time.Since(Progress.StartTime).Round(time.Second)
-	log.Printf("Successfully processed %d/%d Google Keep notes in %s",
-		Progress.ProcessedNotes, Progress.TotalNotes, duration)
-	log.Printf("Skipped %d notes (archived or errors)", Progress.SkippedNotes)
-	log.Printf("API Stats: %d successful, %d failed, %d retries",
-		Stats.SuccessfulCalls, Stats.FailedCalls, Stats.Retries)
-}
+	if Opts.BatchSize > 1 && Opts.DocID == "" {
+		log.Printf("Warning: -batch-size only applies with -doc-id, inbox notes are added one per call")
+	}
+	if len(Opts.LabelColors) > 0 && Opts.DocID == "" {
+		log.Printf("Warning: -label-color only applies with -doc-id, the inbox API can't color items")
+	}
+
+	// Validate that the provided paths exist and are directories or zip archives
+	for _, takeoutPath := range takeoutPaths {
+		if err := conv.OpenTakeout(takeoutPath); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+	}
 
-// countJsonFiles counts the total number of JSON files in the folder
-func countJsonFiles(folderPath string) {
-	filepath.Walk(folderPath, func(filePath string, fileInfo os.FileInfo, err error) error {
+	// Restrict processing to the Keep part of a multi-product takeout
+	for i, takeoutPath := range takeoutPaths {
+		takeoutPaths[i] = resolveKeepFolder(conv, takeoutPath, *keepSubdir)
+	}
+
+	// Validate the takeout without sending anything
+	if *validateOnly {
+		report, err := conv.Validate(takeoutPaths...)
 		if err != nil {
-			return nil
+			log.Printf("Error validating Google Keep folder: %v", err)
+			return 1
 		}
-		if !fileInfo.IsDir() && filepath.Ext(filePath) == ".json" {
-			Progress.TotalNotes++
+		logValidationReport(report)
+		if validationFailed(report, *allowWarnings) {
+			return 1
 		}
-		return nil
-	})
-}
+		return 0
+	}
 
-// displayProgress shows the current progress
-func displayProgress() {
-	percent := float64(Progress.ProcessedNotes) / float64(Progress.TotalNotes) * 100
-	elapsed := time.Since(Progress.StartTime).Round(time.Second)
+	// Expose the run statistics for scraping until the run is interrupted or ends
+	if *metricsAddr != "" {
+		if err := startMetricsServer(ctx, *metricsAddr, conv); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+	}
 
-	// Create a simple progress bar
-	width := 30
-	completed := int(float64(width) * float64(Progress.ProcessedNotes) / float64(Progress.TotalNotes))
-	bar := strings.Repeat("=", completed) + strings.Repeat(" ", width-completed)
+	// Validate environment variables
+	if Opts.Token == "" && !Opts.DryRun && Opts.OutDir == "" {
+		if *tokenFile != "" {
+			log.Printf("Error: token file %s is empty", *tokenFile)
+			return 1
+		}
+		log.Print("DYNALIST_TOKEN environment variable or -token-file must be set")
+		return 1
+	}
 
-	fmt.Printf("\r[%s] %.1f%% (%d/%d) | Elapsed: %s | API: %d ok, %d fail, %d retry | %s",
-		bar, percent, Progress.ProcessedNotes, Progress.TotalNotes,
-		elapsed, Stats.SuccessfulCalls, Stats.FailedCalls, Stats.Retries,
-		Stats.LastStatus)
-}
+	// Catch a wrong token up front instead of failing every note
+	if !Opts.DryRun && Opts.OutDir == "" {
+		err := conv.CheckToken(ctx)
+		if errors.Is(err, converter.ErrInvalidToken) {
+			log.Print("Error: Dynalist rejected DYNALIST_TOKEN, check that it is valid")
+			return 1
+		} else if err != nil {
+			log.Printf("Warning: could not verify DYNALIST_TOKEN, continuing anyway: %v", err)
+		}
+	}
 
-func processKeepFolder(folderPath string, dynalistToken string, r2Client *CloudflareR2Client) error {
-	// Walk through the folder
-	return filepath.Walk(folderPath, func(filePath string, fileInfo os.FileInfo, err error) error {
-		if err != nil {
-			return err
+	// Index the previous export to only migrate new or changed notes
+	if *previousTakeout != "" {
+		if err := conv.OpenTakeout(*previousTakeout); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+		if err := conv.LoadPreviousExport(resolveKeepFolder(conv, *previousTakeout, *keepSubdir)); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
+		}
+	}
+
+	// Count total notes first, leaving out those earlier runs migrated
+	total, err := conv.CountNotes(takeoutPaths...)
+	if err != nil {
+		log.Printf("Error: %v", err)
+		return 1
+	}
+	if Opts.State != nil {
+		logInfo("Found %d JSON files the state file doesn't list yet", total)
+	} else {
+		logInfo("Found %d total JSON files to process", total)
+	}
+	if Opts.Limit > 0 {
+		total = min(total, Opts.Limit)
+	}
+
+	// Guard against accidentally importing a huge folder
+	if total > *confirmThreshold && !*assumeYes && !Opts.DryRun && Opts.OutDir == "" && isTerminal(os.Stdin) {
+		if !confirm(fmt.Sprintf("About to send up to %d notes to Dynalist. Continue?", total)) {
+			log.Print("Aborted by user")
+			return 1
+		}
+	}
+
+	// Process Google Keep folder
+	err = conv.ProcessFolder(ctx, takeoutPaths...)
+	interrupted := errors.Is(err, context.Canceled)
+	if interrupted {
+		log.Printf("Migration interrupted, re-run to continue")
+		exitCode = 1
+	} else if err != nil {
+		log.Printf("Error processing Google Keep folder: %v", err)
+		return 1
+	}
+
+	// Display final statistics
+	stats := conv.Stats()
+	progress, uploads, api := stats.Progress, stats.Uploads, stats.API
+	duration := time.Since(progress.StartTime).Round(time.Second)
+	log.Printf("Successfully processed %d/%d Google Keep notes in %s",
+		progress.ProcessedNotes, progress.TotalNotes, duration)
+	if Opts.Limit > 0 && progress.ProcessedNotes >= Opts.Limit {
+		log.Printf("Stopped at the limit of %d notes, run again to migrate more", Opts.Limit)
+	}
+	log.Printf("Skipped %d notes", progress.Skipped())
+	for _, skip := range progress.SkipCounts() {
+		if skip.Count > 0 {
+			log.Printf("  %d %s", skip.Count, skip.Description)
 		}
+	}
+	if *previousTakeout != "" {
+		log.Printf("Compared to previous export: %d new, %d changed, %d unchanged (skipped)",
+			progress.NewNotes, progress.ChangedNotes, progress.UnchangedNotes)
+	}
+	if first, second := stats.FirstPass, stats.RetryPass; second.Migrated > 0 || second.Failed > 0 {
+		log.Printf("First pass: %d notes migrated, %d failed; API %d ok, %d fail",
+			first.Migrated, first.Failed, first.API.SuccessfulCalls, first.API.FailedCalls)
+		log.Printf("Retry pass: %d notes recovered, %d failed permanently; API %d ok, %d fail",
+			second.Migrated, second.Failed, second.API.SuccessfulCalls, second.API.FailedCalls)
+	}
+	if progress.SkippedUploads > 0 {
+		log.Printf("Left out %d attachments by type or size", progress.SkippedUploads)
+	}
+	if uploads.Deduplicated > 0 {
+		log.Printf("Avoided %d duplicate attachment uploads", uploads.Deduplicated)
+	}
+	if t := stats.Timings; t.Notes > 0 {
+		log.Printf("Timing: per note on average %s parsing, %s uploading, %s adding",
+			t.Average(t.Parse).Round(time.Microsecond), t.Average(t.Upload).Round(time.Microsecond), t.Average(t.Add).Round(time.Microsecond))
+	}
+	if uploads.Retries > 0 || uploads.Failed > 0 {
+		log.Printf("Upload Stats: %d successful, %d failed, %d retries",
+			uploads.Successful, uploads.Failed, uploads.Retries)
+	}
+	log.Printf("API Stats (total): %d successful, %d failed, %d retries, pause up to %s",
+		api.SuccessfulCalls, api.FailedCalls, api.Retries, api.PauseCeiling.Round(time.Millisecond))
+
+	// Let scripts tell an incomplete migration from a clean one
+	if exitCode == 0 && migrationFailed(stats, *strict) {
+		log.Printf("Error: the migration is incomplete, see the failures above")
+		exitCode = exitIncomplete
+	}
 
-		// Skip directories
-		if fileInfo.IsDir() {
-			return nil
+	if *failuresFile != "" {
+		failures := conv.Failures()
+		if err := writeFailures(*failuresFile, failures); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
 		}
+		log.Printf("Wrote %d failed notes to %s", len(failures), *failuresFile)
+	}
 
-		// Process only JSON files
-		if filepath.Ext(filePath) != ".json" {
-			return nil
+	if *tagReport != "" {
+		if err := conv.WriteTagReport(*tagReport); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
 		}
+		log.Printf("Wrote tag report for %d tags to %s", len(stats.TagCounts), *tagReport)
+	}
 
-		// Parse the Keep Note
-		note, err := parseKeepNote(filePath)
-		if err != nil {
-			log.Printf("Failed to parse Keep note: %v", err)
-			Progress.SkippedNotes++
-			displayProgress()
-			return nil // Continue processing other files
+	if *runReport != "" {
+		if err := writeRunReport(*runReport, newRunReport(conv.RunID(), stats, takeoutPaths, conv.Failures(), interrupted)); err != nil {
+			log.Printf("Error: %v", err)
+			return 1
 		}
+		log.Printf("Wrote run report to %s", *runReport)
+	}
+
+	return exitCode
+}
 
-		// Ignore archived notes
-		if note.IsArchived {
-			log.Printf("Ignoring archived note: %s", filePath)
-			Progress.SkippedNotes++
-			displayProgress()
-			return nil
+// parseDateOptions resolves the -timezone flag and parses the -since and -until
+// dates as days in that time zone
+func parseDateOptions(timezone string, since string, until string) error {
+	Opts.Location = time.Local
+	if timezone != "" {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			return fmt.Errorf("invalid time zone %q: %w", timezone, err)
 		}
+		Opts.Location = loc
+	}
 
-		// Process the message
-		err = processMessage(note, folderPath, dynalistToken, r2Client, filePath)
+	if since != "" {
+		date, err := time.ParseInLocation(time.DateOnly, since, Opts.Location)
 		if err != nil {
-			log.Printf("Failed to process message: %v", err)
-			Progress.SkippedNotes++
-			displayProgress()
-			return nil // Continue processing other files
+			return fmt.Errorf("invalid -since date: %w", err)
 		}
+		Opts.Since = date
+	}
+	if until != "" {
+		date, err := time.ParseInLocation(time.DateOnly, until, Opts.Location)
+		if err != nil {
+			return fmt.Errorf("invalid -until date: %w", err)
+		}
+		Opts.Until = date.AddDate(0, 0, 1) // Include the whole day
+	}
+	return nil
+}
 
-		// Update progress
-		Progress.ProcessedNotes++
-		displayProgress()
-		return nil
-	})
+// exitIncomplete is the exit status of a run that finished with failed notes
+const exitIncomplete = 2
+
+// migrationFailed reports whether notes failed permanently or couldn't be read,
+// or, in strict mode, whether anything at all went wrong along the way
+func migrationFailed(stats converter.RunStats, strict bool) bool {
+	if stats.Progress.FailedNotes > 0 || stats.Progress.UnparsedNotes > 0 {
+		return true
+	}
+	return strict && (stats.API.FailedCalls > 0 || stats.API.Retries > 0 ||
+		stats.Uploads.Failed > 0 || stats.Uploads.Retries > 0 || stats.Progress.RecoveredNotes > 0)
 }
 
-func processMessage(note *KeepNote, folderPath string, dynalistToken string, r2Client *CloudflareR2Client, filePath string) error {
-	var attachmentLinks []string
-	// Process attachments
-	if r2Client != nil && len(note.Attachments) > 0 {
-		for _, attachment := range note.Attachments {
-			attachmentFile, err := findAttachmentFile(folderPath, attachment.FilePath)
-			if err != nil {
-				log.Printf("Failed to find attachment file: %v", err)
-				continue // Continue processing other attachments
-			}
+// validationFailed reports whether a validation run found problems or, unless
+// warnings are allowed, notes that are skipped or split when migrated
+func validationFailed(report *converter.ValidationReport, allowWarnings bool) bool {
+	return report.ProblemCount() > 0 || (!allowWarnings && report.WarningCount() > 0)
+}
 
-			r2URL, err := r2Client.UploadLocalFile(attachmentFile)
-			if err != nil {
-				log.Printf("Failed to upload attachment: %v", err)
-				continue // Continue processing other attachments
-			}
+// resolveKeepFolder returns the Keep subdirectory of a takeout folder, looking
+// both directly inside it and inside a "Takeout" folder. When the subdirectory
+// doesn't exist the takeout folder is assumed to already be the Keep folder.
+func resolveKeepFolder(conv *converter.Converter, takeoutPath string, subdir string) string {
+	if subdir == "" {
+		return takeoutPath
+	}
 
-			attachmentLinks = append(attachmentLinks, fmt.Sprintf("[%s](%s)", attachment.FilePath, r2URL))
+	candidates := []string{
+		filepath.Join(takeoutPath, subdir),
+		filepath.Join(takeoutPath, "Takeout", subdir),
+	}
+	for _, candidate := range candidates {
+		if conv.IsTakeoutDir(candidate) {
+			logInfo("Processing Keep notes in %s", candidate)
+			return candidate
 		}
 	}
 
-	// Process labels
-	hashtags := processLabels(note.Labels)
-
-	// Format the note content
-	noteContent := note.TextContent
-	if len(attachmentLinks) > 0 {
-		noteContent += "\n\nAttachments:\n" + strings.Join(attachmentLinks, "\n")
-	}
-	// Tags will now go in the title, not in the note content
-
-	// Set the title
-	title := note.Title
-	if title == "" {
-		// Use shortened filename
-		baseTitle := shortenFilename(filePath)
-
-		// Add first few lines of content to title if available
-		if note.TextContent != "" {
-			// Get first few lines of content
-			contentLines := strings.Split(note.TextContent, "\n")
-			previewText := ""
-
-			// Take up to 2 non-empty lines for the preview
-			lineCount := 0
-			for _, line := range contentLines {
-				trimmedLine := strings.TrimSpace(line)
-				if trimmedLine != "" {
-					if previewText != "" {
-						previewText += " | "
-					}
-					// Limit each line to 30 chars
-					if len(trimmedLine) > 30 {
-						previewText += trimmedLine[:30] + "..."
-					} else {
-						previewText += trimmedLine
-					}
-
-					lineCount++
-					if lineCount >= 2 {
-						break
-					}
-				}
-			}
+	return takeoutPath
+}
 
-			if previewText != "" {
-				title = baseTitle + ": " + previewText
-			} else {
-				title = baseTitle
-			}
-		} else {
-			title = baseTitle
-		}
+// logInfo logs a progress message that -q suppresses, unlike problems and the final summary
+func logInfo(format string, args ...any) {
+	if !Opts.Quiet {
+		log.Printf(format, args...)
 	}
+}
+
+// confirm asks a yes/no question on the terminal and reports whether the user agreed
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	var answer string
+	fmt.Scanln(&answer)
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
 
-	// Add prefix and tags to title
-	title = "gkeep: " + title
-	if hashtags != "" {
-		title += " " + hashtags
+// writeFailures writes the paths of permanently failed notes to a file, one per line
+func writeFailures(path string, filePaths []string) error {
+	var content strings.Builder
+	for _, filePath := range filePaths {
+		content.WriteString(filePath + "\n")
+	}
+	if err := os.WriteFile(path, []byte(content.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write failures file: %w", err)
 	}
+	return nil
+}
 
-	// Forward the message to Dynalist
-	err := AddToDynalist(dynalistToken, title, noteContent)
+// readTokenFile reads a Dynalist token from a file, without surrounding whitespace
+func readTokenFile(path string) (string, error) {
+	data, err := os.ReadFile(path)
 	if err != nil {
-		log.Printf("Failed to add message to Dynalist: %v", err)
-		return err
+		return "", fmt.Errorf("failed to read token file: %w", err)
 	}
+	return strings.TrimSpace(string(data)), nil
+}
 
-	return nil
+// isTerminal reports whether the file is an interactive terminal
+func isTerminal(file *os.File) bool {
+	fileInfo, err := file.Stat()
+	if err != nil {
+		return false
+	}
+	return fileInfo.Mode()&os.ModeCharDevice != 0
+}
+
+// logValidationReport prints the aggregated problem counts of a validation run
+func logValidationReport(report *converter.ValidationReport) {
+	log.Printf("Validated %d JSON files, found %d problems and %d warnings", report.CheckedNotes, report.ProblemCount(), report.WarningCount())
+	log.Printf("  Unparseable files:   %d", len(report.ParseErrors))
+	log.Printf("  Not Keep notes:      %d (ignored)", len(report.IgnoredFiles))
+	log.Printf("  Missing attachments: %d", len(report.MissingAttachments))
+	log.Printf("  Items without text:  %d", len(report.EmptyItems))
+	log.Printf("  Empty notes:         %d (warning, skipped)", len(report.EmptyNotes))
+	log.Printf("  Oversized notes:     %d (warning, split)", len(report.OversizedNotes))
 }
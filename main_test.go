@@ -0,0 +1,57 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/korjavin/gkeep2dynalist/converter"
+)
+
+func TestMigrationFailed(t *testing.T) {
+	tests := []struct {
+		name   string
+		stats  converter.RunStats
+		strict bool
+		want   bool
+	}{
+		{name: "clean run", want: false},
+		{name: "failed notes", stats: converter.RunStats{Progress: converter.ProgressStats{FailedNotes: 1}}, want: true},
+		{name: "unparsed notes", stats: converter.RunStats{Progress: converter.ProgressStats{UnparsedNotes: 2}}, want: true},
+		{name: "intentional skips", stats: converter.RunStats{Progress: converter.ProgressStats{ArchivedNotes: 3, FilteredNotes: 1, EmptyNotes: 1}}, want: false},
+		{name: "recovered notes", stats: converter.RunStats{Progress: converter.ProgressStats{RecoveredNotes: 1}}, want: false},
+		{name: "recovered notes in strict mode", stats: converter.RunStats{Progress: converter.ProgressStats{RecoveredNotes: 1}}, strict: true, want: true},
+		{name: "API retries", stats: converter.RunStats{API: converter.RetryStats{Retries: 1}}, want: false},
+		{name: "API retries in strict mode", stats: converter.RunStats{API: converter.RetryStats{Retries: 1}}, strict: true, want: true},
+		{name: "failed uploads in strict mode", stats: converter.RunStats{Uploads: converter.UploadStats{Failed: 1}}, strict: true, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := migrationFailed(tt.stats, tt.strict); got != tt.want {
+				t.Errorf("migrationFailed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestValidationFailed(t *testing.T) {
+	tests := []struct {
+		name          string
+		report        converter.ValidationReport
+		allowWarnings bool
+		want          bool
+	}{
+		{name: "clean takeout", want: false},
+		{name: "parse errors", report: converter.ValidationReport{ParseErrors: []string{"a.json"}}, want: true},
+		{name: "parse errors with warnings allowed", report: converter.ValidationReport{ParseErrors: []string{"a.json"}}, allowWarnings: true, want: true},
+		{name: "empty notes", report: converter.ValidationReport{EmptyNotes: []string{"a.json"}}, want: true},
+		{name: "oversized notes", report: converter.ValidationReport{OversizedNotes: []string{"a.json"}}, want: true},
+		{name: "warnings allowed", report: converter.ValidationReport{EmptyNotes: []string{"a.json"}, OversizedNotes: []string{"b.json"}}, allowWarnings: true, want: false},
+		{name: "ignored files", report: converter.ValidationReport{IgnoredFiles: []string{"a.json"}}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := validationFailed(&tt.report, tt.allowWarnings); got != tt.want {
+				t.Errorf("validationFailed() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
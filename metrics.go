@@ -0,0 +1,99 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/korjavin/gkeep2dynalist/converter"
+)
+
+// metricsShutdownTimeout bounds how long the metrics server waits for open scrapes
+const metricsShutdownTimeout = 5 * time.Second
+
+// metric is one sample in the Prometheus text exposition format
+type metric struct {
+	name   string
+	kind   string // counter or gauge
+	help   string
+	labels string // e.g. `result="success"`, empty for none
+	value  float64
+}
+
+// startMetricsServer serves the run statistics as Prometheus metrics on
+// addr at /metrics until the context is cancelled
+func startMetricsServer(ctx context.Context, addr string, conv *converter.Converter) error {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen for metrics on %s: %w", addr, err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		writeMetrics(w, collectMetrics(conv.Stats()))
+	})
+	server := &http.Server{Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Printf("Warning: metrics server stopped: %v", err)
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logInfo("Serving metrics on http://%s/metrics", listener.Addr())
+	return nil
+}
+
+// collectMetrics converts a snapshot of the progress, API and upload statistics
+func collectMetrics(stats converter.RunStats) []metric {
+	p, s, u := stats.Progress, stats.API, stats.Uploads
+	metrics := []metric{
+		{name: "gkeep2dynalist_notes", kind: "gauge", help: "Notes found in the takeout.", value: float64(p.TotalNotes)},
+		{name: "gkeep2dynalist_notes_processed_total", kind: "counter", help: "Notes migrated.", value: float64(p.ProcessedNotes)},
+		{name: "gkeep2dynalist_notes_failed_total", kind: "counter", help: "Notes that failed on the retry pass too.", value: float64(p.FailedNotes)},
+		{name: "gkeep2dynalist_notes_recovered_total", kind: "counter", help: "Notes that succeeded on the retry pass.", value: float64(p.RecoveredNotes)},
+	}
+	for i, skip := range p.SkipCounts() {
+		m := metric{name: "gkeep2dynalist_notes_skipped_total", labels: fmt.Sprintf("reason=%q", skip.Key), value: float64(skip.Count)}
+		if i == 0 {
+			m.kind, m.help = "counter", "Notes skipped, by reason."
+		}
+		metrics = append(metrics, m)
+	}
+	return append(metrics,
+		metric{name: "gkeep2dynalist_api_calls_total", kind: "counter", help: "Dynalist API calls by result.", labels: `result="success"`, value: float64(s.SuccessfulCalls)},
+		metric{name: "gkeep2dynalist_api_calls_total", labels: `result="failure"`, value: float64(s.FailedCalls)},
+		metric{name: "gkeep2dynalist_api_retries_total", kind: "counter", help: "Retried Dynalist API calls.", value: float64(s.Retries)},
+		metric{name: "gkeep2dynalist_attachments_uploaded_total", kind: "counter", help: "Attachments uploaded.", value: float64(u.Successful)},
+		metric{name: "gkeep2dynalist_attachment_upload_failures_total", kind: "counter", help: "Attachments that failed to upload on every attempt.", value: float64(u.Failed)},
+		metric{name: "gkeep2dynalist_attachment_upload_retries_total", kind: "counter", help: "Retried attachment uploads.", value: float64(u.Retries)},
+		metric{name: "gkeep2dynalist_attachment_uploads_deduplicated_total", kind: "counter", help: "Attachment uploads avoided because the file was already uploaded.", value: float64(u.Deduplicated)},
+	)
+}
+
+// writeMetrics writes metrics in the Prometheus text format. A metric without
+// help text continues the series of the one before it.
+func writeMetrics(w io.Writer, metrics []metric) {
+	for _, m := range metrics {
+		if m.help != "" {
+			fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", m.name, m.help, m.name, m.kind)
+		}
+		if m.labels != "" {
+			fmt.Fprintf(w, "%s{%s} %g\n", m.name, m.labels, m.value)
+		} else {
+			fmt.Fprintf(w, "%s %g\n", m.name, m.value)
+		}
+	}
+}
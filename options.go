@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/korjavin/gkeep2dynalist/converter"
+)
+
+// Global options, populated from command-line flags in main
+var Opts converter.Options
+
+// stringList is a repeatable flag that also accepts comma-separated values
+type stringList []string
+
+func (l *stringList) String() string {
+	return strings.Join(*l, ",")
+}
+
+func (l *stringList) Set(value string) error {
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			*l = append(*l, item)
+		}
+	}
+	return nil
+}
+
+// labelMap is a repeatable flag of "From=To" label renames
+type labelMap map[string]string
+
+func (m *labelMap) String() string {
+	var pairs []string
+	for from, to := range *m {
+		pairs = append(pairs, from+"="+to)
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (m *labelMap) Set(value string) error {
+	from, to, ok := strings.Cut(value, "=")
+	if !ok || from == "" || strings.TrimSpace(to) == "" {
+		return fmt.Errorf("expected From=To, got %q", value)
+	}
+	if *m == nil {
+		*m = make(labelMap)
+	}
+	(*m)[from] = to
+	return nil
+}
+
+// labelColors is a repeatable flag of "Label=color" node colors
+type labelColors []converter.LabelColor
+
+func (l *labelColors) String() string {
+	var pairs []string
+	for _, lc := range *l {
+		pairs = append(pairs, lc.Label+"="+lc.Color)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (l *labelColors) Set(value string) error {
+	label, color, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(label) == "" || strings.TrimSpace(color) == "" {
+		return fmt.Errorf("expected Label=color, got %q", value)
+	}
+	*l = append(*l, converter.LabelColor{Label: label, Color: strings.TrimSpace(color)})
+	return nil
+}
+
+// configEnvVars lists the environment variables the tool reads
+var configEnvVars = []string{
+	"DYNALIST_TOKEN",
+	"CF_ACCOUNT_ID",
+	"CF_ACCESS_KEY_ID",
+	"CF_ACCESS_KEY_SECRET",
+	"CF_BUCKET_NAME",
+	"STORAGE_BACKEND",
+	"MEDIA_DIR",
+	"PUBLIC_BASE_URL",
+	"S3_BUCKET_NAME",
+	"AWS_REGION",
+	"AWS_ACCESS_KEY_ID",
+	"AWS_SECRET_ACCESS_KEY",
+}
+
+// secretEnvVars lists the environment variables whose values must never be logged
+var secretEnvVars = map[string]bool{
+	"DYNALIST_TOKEN":        true,
+	"CF_ACCESS_KEY_ID":      true,
+	"CF_ACCESS_KEY_SECRET":  true,
+	"AWS_ACCESS_KEY_ID":     true,
+	"AWS_SECRET_ACCESS_KEY": true,
+}
+
+// logConfig logs every flag and environment variable as resolved for this run
+func logConfig() {
+	log.Printf("Effective configuration:")
+	flag.VisitAll(func(f *flag.Flag) {
+		log.Printf("  -%s=%s", f.Name, f.Value.String())
+	})
+	for _, name := range configEnvVars {
+		value := os.Getenv(name)
+		if value != "" && secretEnvVars[name] {
+			value = "****"
+		}
+		log.Printf("  %s=%s", name, value)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/korjavin/gkeep2dynalist/converter"
+)
+
+// RunReport is the summary of a migration run written by -report
+type RunReport struct {
+	RunID       string         `json:"run_id"`
+	Takeouts    []string       `json:"takeouts"`
+	StartTime   time.Time      `json:"start_time"`
+	Duration    string         `json:"duration"`
+	Interrupted bool           `json:"interrupted"`
+	Total       int            `json:"total"`
+	Processed   int            `json:"processed"`
+	Skipped     int            `json:"skipped"`
+	Failed      int            `json:"failed"`
+	Recovered   int            `json:"recovered"`
+	SkipReasons map[string]int `json:"skip_reasons"`
+	API         APIReport      `json:"api"`
+	Uploads     UploadReport   `json:"uploads"`
+	FailedFiles []string       `json:"failed_files"`
+	Timing      *TimingReport  `json:"timing,omitempty"`
+}
+
+// APIReport holds the Dynalist API statistics of a run
+type APIReport struct {
+	TotalCalls      int `json:"total_calls"`
+	SuccessfulCalls int `json:"successful_calls"`
+	FailedCalls     int `json:"failed_calls"`
+	Retries         int `json:"retries"`
+}
+
+// UploadReport holds the attachment upload statistics of a run
+type UploadReport struct {
+	Successful   int `json:"successful"`
+	Failed       int `json:"failed"`
+	Retries      int `json:"retries"`
+	Deduplicated int `json:"deduplicated"`
+}
+
+// TimingReport holds the average phase timings of migrated notes with -profile
+type TimingReport struct {
+	Notes         int     `json:"notes"`
+	AvgParseMS    float64 `json:"avg_parse_ms"`
+	AvgUploadMS   float64 `json:"avg_upload_ms"`
+	AvgDynalistMS float64 `json:"avg_dynalist_ms"`
+}
+
+// newRunReport collects the statistics of the finished run
+func newRunReport(runID string, stats converter.RunStats, takeoutPaths []string, failures []string, interrupted bool) *RunReport {
+	if failures == nil {
+		failures = []string{}
+	}
+	p := stats.Progress
+	skipReasons := make(map[string]int)
+	for _, skip := range p.SkipCounts() {
+		skipReasons[skip.Key] = skip.Count
+	}
+	var timing *TimingReport
+	if t := stats.Timings; t.Notes > 0 {
+		timing = &TimingReport{
+			Notes:         t.Notes,
+			AvgParseMS:    milliseconds(t.Average(t.Parse)),
+			AvgUploadMS:   milliseconds(t.Average(t.Upload)),
+			AvgDynalistMS: milliseconds(t.Average(t.Add)),
+		}
+	}
+	return &RunReport{
+		RunID:       runID,
+		Takeouts:    takeoutPaths,
+		StartTime:   p.StartTime,
+		Duration:    time.Since(p.StartTime).Round(time.Second).String(),
+		Interrupted: interrupted,
+		Total:       p.TotalNotes,
+		Processed:   p.ProcessedNotes,
+		Skipped:     p.Skipped(),
+		Failed:      p.FailedNotes,
+		Recovered:   p.RecoveredNotes,
+		SkipReasons: skipReasons,
+		API: APIReport{
+			TotalCalls:      stats.API.TotalCalls,
+			SuccessfulCalls: stats.API.SuccessfulCalls,
+			FailedCalls:     stats.API.FailedCalls,
+			Retries:         stats.API.Retries,
+		},
+		Uploads: UploadReport{
+			Successful:   stats.Uploads.Successful,
+			Failed:       stats.Uploads.Failed,
+			Retries:      stats.Uploads.Retries,
+			Deduplicated: stats.Uploads.Deduplicated,
+		},
+		FailedFiles: failures,
+		Timing:      timing,
+	}
+}
+
+// milliseconds converts a duration to fractional milliseconds
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// writeRunReport writes the report as Markdown when the path ends in .md, and as JSON otherwise
+func writeRunReport(path string, report *RunReport) error {
+	var data []byte
+	if strings.EqualFold(filepath.Ext(path), ".md") {
+		data = []byte(report.Markdown())
+	} else {
+		var err error
+		if data, err = json.MarshalIndent(report, "", "  "); err != nil {
+			return fmt.Errorf("failed to encode report: %w", err)
+		}
+	}
+	if err := os.WriteFile(path, data, 0644); err != nil {
+		return fmt.Errorf("failed to write report: %w", err)
+	}
+	return nil
+}
+
+// Markdown renders the report as a Markdown document
+func (r *RunReport) Markdown() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "# Migration report\n\n")
+	fmt.Fprintf(&b, "- Run ID: %s\n", r.RunID)
+	fmt.Fprintf(&b, "- Takeout: %s\n", strings.Join(r.Takeouts, ", "))
+	fmt.Fprintf(&b, "- Started: %s\n", r.StartTime.Format(time.RFC3339))
+	fmt.Fprintf(&b, "- Duration: %s\n", r.Duration)
+	if r.Interrupted {
+		fmt.Fprintf(&b, "- **Interrupted before completion**\n")
+	}
+
+	fmt.Fprintf(&b, "\n## Notes\n\n| | Count |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Total | %d |\n| Processed | %d |\n| Skipped | %d |\n| Failed | %d |\n| Recovered on retry | %d |\n",
+		r.Total, r.Processed, r.Skipped, r.Failed, r.Recovered)
+
+	fmt.Fprintf(&b, "\n## Skip reasons\n\n| Reason | Count |\n|---|---|\n")
+	reasons := make([]string, 0, len(r.SkipReasons))
+	for reason := range r.SkipReasons {
+		reasons = append(reasons, reason)
+	}
+	sort.Strings(reasons)
+	for _, reason := range reasons {
+		fmt.Fprintf(&b, "| %s | %d |\n", reason, r.SkipReasons[reason])
+	}
+
+	fmt.Fprintf(&b, "\n## Dynalist API\n\n| | Count |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Calls | %d |\n| Successful | %d |\n| Failed | %d |\n| Retries | %d |\n",
+		r.API.TotalCalls, r.API.SuccessfulCalls, r.API.FailedCalls, r.API.Retries)
+
+	fmt.Fprintf(&b, "\n## Attachment uploads\n\n| | Count |\n|---|---|\n")
+	fmt.Fprintf(&b, "| Successful | %d |\n| Failed | %d |\n| Retries | %d |\n| Deduplicated | %d |\n",
+		r.Uploads.Successful, r.Uploads.Failed, r.Uploads.Retries, r.Uploads.Deduplicated)
+
+	if r.Timing != nil {
+		fmt.Fprintf(&b, "\n## Average time per note\n\n| Phase | Milliseconds |\n|---|---|\n")
+		fmt.Fprintf(&b, "| Parse | %.1f |\n| Attachment uploads | %.1f |\n| Dynalist | %.1f |\n",
+			r.Timing.AvgParseMS, r.Timing.AvgUploadMS, r.Timing.AvgDynalistMS)
+		fmt.Fprintf(&b, "\nAveraged over %d migrated notes.\n", r.Timing.Notes)
+	}
+
+	fmt.Fprintf(&b, "\n## Failed files\n\n")
+	if len(r.FailedFiles) == 0 {
+		fmt.Fprintf(&b, "None\n")
+	}
+	for _, filePath := range r.FailedFiles {
+		fmt.Fprintf(&b, "- %s\n", filePath)
+	}
+	return b.String()
+}